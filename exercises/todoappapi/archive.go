@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// An archive is everything a workspace holds, todos with their ids, parents, blockers and
+// timestamps and the reminders that went out, as JSON Lines. It doesn't care which store or
+// workspace it came from, so it is also how todos move between postgres, sqlite and the memory
+// store, and from one workspace to another.
+//
+// The first line is the header, then one line per todo in id order, then the reminders and
+// finally a trailer with the counts. An archive without its trailer was cut off and is refused.
+//
+//	{"format":"todoapp-archive","version":1,"exported_at":"2026-10-19T13:00:00Z","store":"postgres","workspace":"default"}
+//	{"todo":{"id":1,"description":"pet dog","done":true,"priority":"none","created_at":"..."}}
+//	{"reminder":{"todo_id":2,"kind":"overdue","due_date":"2023-11-25","sent_at":"..."}}
+//	{"end":{"todos":2,"reminders":1}}
+
+const (
+	archiveFormat = "todoapp-archive"
+	// archiveVersion goes up whenever a change to the lines would trip up an older restore
+	archiveVersion = 1
+)
+
+var (
+	// errNotEmpty is what Restore says when there are todos already and it wasn't asked to replace them
+	errNotEmpty = errors.New("store already has todos")
+	// errIDTaken means an archived todo has the id of a todo in another workspace
+	errIDTaken = errors.New("todo id is taken in another workspace")
+)
+
+// storedTodo is a todo along with what the stores keep about it beyond the model
+type storedTodo struct {
+	todo
+	createdAt time.Time
+	doneAt    time.Time // zero while open, and for todos done before the stores kept track
+}
+
+// sentReminder is a reminder that went out, see reminderStore.ClaimReminder
+type sentReminder struct {
+	todo    int
+	kind    reminderKind
+	duedate time.Time
+	sentAt  time.Time
+}
+
+type archiveHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Store      string    `json:"store,omitempty"`
+	Workspace  string    `json:"workspace,omitempty"`
+}
+
+// archiveLine is every line after the header, exactly one of the fields is set
+type archiveLine struct {
+	Todo     *archivedTodo     `json:"todo,omitempty"`
+	Reminder *archivedReminder `json:"reminder,omitempty"`
+	End      *archiveEnd       `json:"end,omitempty"`
+}
+
+type archivedTodo struct {
+	ID          int        `json:"id"`
+	Description string     `json:"description"`
+	Done        bool       `json:"done"`
+	DueDate     string     `json:"due_date,omitempty"`
+	Priority    string     `json:"priority"`
+	Tags        []string   `json:"tags,omitempty"`
+	Project     string     `json:"project,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	ParentID    int        `json:"parent_id,omitempty"`
+	BlockedBy   []int      `json:"blocked_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DoneAt      *time.Time `json:"done_at,omitempty"`
+}
+
+type archivedReminder struct {
+	TodoID  int       `json:"todo_id"`
+	Kind    string    `json:"kind"`
+	DueDate string    `json:"due_date"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+type archiveEnd struct {
+	Todos     int `json:"todos"`
+	Reminders int `json:"reminders"`
+}
+
+// writeArchive streams the workspace of ctx in s to w, storeName and the workspace go into the
+// header for people to read
+func writeArchive(ctx context.Context, w io.Writer, s todoStore, storeName string) (archiveEnd, error) {
+	var end archiveEnd
+	enc := json.NewEncoder(w) // Encode ends every value with a newline, which is all JSON Lines needs
+	header := archiveHeader{Format: archiveFormat, Version: archiveVersion, ExportedAt: time.Now().UTC(), Store: storeName, Workspace: workspaceOf(ctx)}
+	if err := enc.Encode(header); err != nil {
+		return end, err
+	}
+
+	err := s.Export(ctx,
+		func(t storedTodo) error {
+			end.Todos++
+			return enc.Encode(archiveLine{Todo: toArchivedTodo(t)})
+		},
+		func(r sentReminder) error {
+			end.Reminders++
+			return enc.Encode(archiveLine{Reminder: &archivedReminder{r.todo, string(r.kind), r.duedate.Format(time.DateOnly), r.sentAt.UTC()}})
+		})
+	if err != nil {
+		return end, err
+	}
+	return end, enc.Encode(archiveLine{End: &end})
+}
+
+func toArchivedTodo(t storedTodo) *archivedTodo {
+	a := &archivedTodo{
+		ID:          t.id,
+		Description: t.description,
+		Done:        t.done,
+		Priority:    t.priority.String(),
+		Tags:        t.tags,
+		Project:     t.project,
+		Recurrence:  t.recurrence.String(),
+		ParentID:    t.parent,
+		BlockedBy:   t.blockedBy,
+		CreatedAt:   t.createdAt.UTC(),
+	}
+	if !t.duedate.IsZero() {
+		a.DueDate = t.duedate.Format(time.DateOnly)
+	}
+	if !t.doneAt.IsZero() {
+		doneAt := t.doneAt.UTC()
+		a.DoneAt = &doneAt
+	}
+	return a
+}
+
+// archiveError is a line of an archive that can't be restored, line 0 is the archive as a whole
+type archiveError struct {
+	line int
+	err  error
+}
+
+func (e *archiveError) Error() string {
+	if e.line == 0 {
+		return "archive: " + e.err.Error()
+	}
+	return fmt.Sprintf("archive line %d: %s", e.line, e.err)
+}
+
+func (e *archiveError) Unwrap() error { return e.err }
+
+// readArchive reads and checks a whole archive. Nothing is written until every line is known to
+// be good, so a broken archive never leaves a half restored store behind.
+func readArchive(r io.Reader) ([]storedTodo, []sentReminder, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+
+	var header archiveHeader
+	if !sc.Scan() {
+		return nil, nil, &archiveError{0, cmp.Or(sc.Err(), errors.New("the archive is empty"))}
+	}
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil || header.Format != archiveFormat {
+		return nil, nil, &archiveError{1, errors.New("not a todoapp archive")}
+	}
+	if header.Version < 1 || header.Version > archiveVersion {
+		return nil, nil, &archiveError{1, fmt.Errorf("archive version %d, this build reads up to version %d", header.Version, archiveVersion)}
+	}
+
+	var (
+		todos     []storedTodo
+		reminders []sentReminder
+		end       *archiveEnd
+	)
+	for n := 2; sc.Scan(); n++ {
+		if end != nil {
+			return nil, nil, &archiveError{n, errors.New("there is more after the end of the archive")}
+		}
+		var l archiveLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			return nil, nil, &archiveError{n, err}
+		}
+		switch {
+		case l.Todo != nil:
+			t, err := l.Todo.toStoredTodo()
+			if err != nil {
+				return nil, nil, &archiveError{n, err}
+			}
+			todos = append(todos, t)
+		case l.Reminder != nil:
+			d, err := time.Parse(time.DateOnly, l.Reminder.DueDate)
+			if err != nil {
+				return nil, nil, &archiveError{n, fmt.Errorf("due_date: %w", err)}
+			}
+			kind := reminderKind(l.Reminder.Kind)
+			if kind != reminderUpcoming && kind != reminderOverdue {
+				return nil, nil, &archiveError{n, fmt.Errorf("unknown reminder kind %q", l.Reminder.Kind)}
+			}
+			reminders = append(reminders, sentReminder{l.Reminder.TodoID, kind, d, l.Reminder.SentAt})
+		case l.End != nil:
+			end = l.End
+		default:
+			return nil, nil, &archiveError{n, errors.New("a line has to have a todo, a reminder or the end")}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, &archiveError{0, err}
+	}
+
+	if end == nil {
+		return nil, nil, &archiveError{0, errors.New("the end line is missing, the archive is incomplete")}
+	}
+	if end.Todos != len(todos) || end.Reminders != len(reminders) {
+		return nil, nil, &archiveError{0, fmt.Errorf("the end line counts %d todos and %d reminders, the archive has %d and %d",
+			end.Todos, end.Reminders, len(todos), len(reminders))}
+	}
+	if err := checkArchiveReferences(todos, reminders); err != nil {
+		return nil, nil, &archiveError{0, err}
+	}
+	return todos, reminders, nil
+}
+
+// toStoredTodo runs the archived todo through the same checks as a new one
+func (a *archivedTodo) toStoredTodo() (storedTodo, error) {
+	in := todoInput{
+		Description: a.Description,
+		Done:        a.Done,
+		Duedate:     a.DueDate,
+		Priority:    a.Priority,
+		Tags:        a.Tags,
+		Project:     a.Project,
+		Recurrence:  a.Recurrence,
+		Parent:      a.ParentID,
+		BlockedBy:   a.BlockedBy,
+	}
+	t, err := in.toTodo()
+	if err != nil {
+		return storedTodo{}, err
+	}
+	if a.ID < 1 {
+		return storedTodo{}, errors.New("id has to be at least 1")
+	}
+	t.id = a.ID
+
+	s := storedTodo{todo: t, createdAt: a.CreatedAt}
+	if s.createdAt.IsZero() {
+		s.createdAt = time.Now().UTC()
+	}
+	if a.DoneAt != nil && a.Done {
+		s.doneAt = *a.DoneAt
+	}
+	return s, nil
+}
+
+// checkArchiveReferences makes sure ids are unique, parents, blockers and reminders point at todos
+// in the archive and neither parents nor blockers go round in a circle. The stores check the
+// references too, but this names the todo that is wrong.
+func checkArchiveReferences(todos []storedTodo, reminders []sentReminder) error {
+	byID := map[int]storedTodo{}
+	for _, t := range todos {
+		if _, ok := byID[t.id]; ok {
+			return fmt.Errorf("todo %d is in there twice", t.id)
+		}
+		byID[t.id] = t
+	}
+
+	for _, t := range todos {
+		if _, ok := byID[t.parent]; t.parent != 0 && !ok {
+			return fmt.Errorf("todo %d: parent %d is not in the archive", t.id, t.parent)
+		}
+		for _, b := range t.blockedBy {
+			if _, ok := byID[b]; !ok {
+				return fmt.Errorf("todo %d: blocker %d is not in the archive", t.id, b)
+			}
+		}
+	}
+	for _, r := range reminders {
+		if _, ok := byID[r.todo]; !ok {
+			return fmt.Errorf("reminder for todo %d, which is not in the archive", r.todo)
+		}
+	}
+
+	parents := func(t storedTodo) []int {
+		if t.parent == 0 {
+			return nil
+		}
+		return []int{t.parent}
+	}
+	blockers := func(t storedTodo) []int { return t.blockedBy }
+	if err := findCycle(byID, parents); err != nil {
+		return err
+	}
+	return findCycle(byID, blockers)
+}
+
+// findCycle walks the edges depth first, an edge back to a todo still on the path is a cycle.
+// Parents and blockers are walked one at a time, like the stores check them.
+func findCycle(byID map[int]storedTodo, edges func(storedTodo) []int) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[int]int{}
+	var walk func(id int) error
+	walk = func(id int) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("todo %d: %w", id, errCycle)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		for _, other := range edges(byID[id]) {
+			if err := walk(other); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		return nil
+	}
+	for id := range byID {
+		if err := walk(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GET /todos/archive streams every todo of the workspace as an archive, the memory store's way out
+func exportArchive(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="todos-%s.jsonl"`, time.Now().UTC().Format(time.DateOnly)))
+	rw.WriteHeader(http.StatusOK)
+	if _, err := writeArchive(r.Context(), rw, store, ""); err != nil {
+		// too late for an error response, the missing end line tells restore the archive is incomplete
+		slog.ErrorContext(r.Context(), "export failed", "err", err)
+	}
+}
+
+// restoreResponse is what PUT /todos/archive answers with
+type restoreResponse struct {
+	Todos     int
+	Reminders int
+}
+
+const maxArchiveSize = 100 << 20
+
+// PUT /todos/archive?replace=true puts the todos of an archive back with their ids, in one
+// transaction. Without replace the workspace has to be empty. Replacing throws a whole workspace
+// away, so it takes the admin key unless TODOAPP_ARCHIVE_REPLACE lets everyone do it.
+func restoreArchive(cfg config) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		replace, err := strconv.ParseBool(cmp.Or(r.URL.Query().Get("replace"), "false"))
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, "invalid_query", "replace has to be true or false")
+			return
+		}
+		if replace && !cfg.archiveReplace && !isAdmin(cfg, r.Header.Get("Authorization")) {
+			writeError(rw, http.StatusForbidden, "replace_not_allowed", "replacing a workspace takes the admin key")
+			return
+		}
+
+		todos, reminders, err := readArchive(http.MaxBytesReader(rw, r.Body, maxArchiveSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeBodyError(rw, err)
+			return
+		}
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, "invalid_archive", err.Error())
+			return
+		}
+		if err := store.Restore(r.Context(), todos, reminders, replace); err != nil {
+			writeStoreError(rw, err)
+			return
+		}
+		writeJSON(rw, http.StatusOK, restoreResponse{Todos: len(todos), Reminders: len(reminders)})
+	}
+}
+
+// `go run . export` writes a workspace of the configured store to stdout, or to -o
+func exportCommand(cfg config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	path := flags.String("o", "", "file to write the archive to instead of stdout")
+	workspace := flags.String("workspace", defaultWorkspace, "workspace to export")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.store == "memory" {
+		return errors.New("export: the memory store only lives inside the api, use GET /todos/archive")
+	}
+	if !workspaceName.MatchString(*workspace) {
+		return fmt.Errorf("export: -workspace: %w", errInvalidWorkspace)
+	}
+
+	w := out
+	if *path != "" {
+		f, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	end, err := writeArchive(withWorkspace(context.Background(), *workspace), bw, openStore(cfg), cfg.store)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	log.Printf("exported %d todos and %d reminders from workspace %s", end.Todos, end.Reminders, *workspace)
+	return nil
+}
+
+// `go run . restore [-replace] [archive.jsonl]` reads an archive from the file or stdin into a
+// workspace of the configured store
+func restoreCommand(cfg config, args []string, _ io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "delete every todo in the workspace first, in the same transaction")
+	workspace := flags.String("workspace", defaultWorkspace, "workspace to restore into")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.store == "memory" {
+		return errors.New("restore: the memory store only lives inside the api, use PUT /todos/archive")
+	}
+	if !workspaceName.MatchString(*workspace) {
+		return fmt.Errorf("restore: -workspace: %w", errInvalidWorkspace)
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.NArg() > 0 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	todos, reminders, err := readArchive(r)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if err := openStore(cfg).Restore(withWorkspace(context.Background(), *workspace), todos, reminders, *replace); err != nil {
+		if errors.Is(err, errNotEmpty) {
+			return fmt.Errorf("restore: workspace %s already has todos, -replace deletes them first", *workspace)
+		}
+		return fmt.Errorf("restore: %w", err)
+	}
+	log.Printf("restored %d todos and %d reminders into workspace %s", len(todos), len(reminders), *workspace)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSQLiteExportDoesNotBlockWriters(t *testing.T) {
+	s := openTestSQLite(t)
+	ctx := context.Background()
+	before, err := s.List(ctx, todoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, created := 0, 0
+	err = s.Export(ctx,
+		func(storedTodo) error {
+			exported++
+			if exported > 1 {
+				return nil
+			}
+			// the export is halfway through and holds its transaction open
+			wctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			nt, err := s.Create(wctx, todo{description: "written during the export"})
+			if err != nil {
+				t.Errorf("create during the export: %v", err)
+			}
+			created = nt.id
+			return nil
+		},
+		func(sentReminder) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported != len(before) {
+		t.Errorf("exported %d todos, there were %d when it started", exported, len(before))
+	}
+	if _, err := s.Get(ctx, created); err != nil {
+		t.Errorf("the todo created during the export is gone: %v", err)
+	}
+}
+
+func TestRestoreReplaceNeedsTheAdminKey(t *testing.T) {
+	admin := testConfig()
+	admin.apiKey = "admin"
+	admin.workspaceKeys = workspaceKeys{"d3s1gn": "design"}
+	allowed := testConfig()
+	allowed.archiveReplace = true
+
+	for _, tc := range []struct {
+		name    string
+		cfg     config
+		key     string
+		replace bool
+		want    int
+	}{
+		{"no keys", testConfig(), "", true, http.StatusForbidden},
+		{"no keys without replace", testConfig(), "", false, http.StatusOK},
+		{"TODOAPP_ARCHIVE_REPLACE", allowed, "", true, http.StatusOK},
+		{"workspace key", admin, "d3s1gn", true, http.StatusForbidden},
+		{"admin key", admin, "admin", true, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := startTestAPI(t, tc.cfg, nil)
+			var archive bytes.Buffer
+			if _, err := writeArchive(context.Background(), &archive, store, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			url := srv.URL + "/todos/archive"
+			if tc.replace {
+				url += "?replace=true"
+			}
+			req, _ := http.NewRequest("PUT", url, &archive)
+			if tc.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.key)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != tc.want {
+				t.Errorf("got %d %s, want %d", res.StatusCode, body, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAPIKey turns every request without an "Authorization: Bearer <key>" header into a 401.
+// It is only installed when TODOAPP_API_KEY is set, with TODOAPP_WORKSPACE_KEYS scopeToWorkspace
+// checks the keys instead.
+func requireAPIKey(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+				rw.Header().Set("WWW-Authenticate", `Bearer realm="todos"`)
+				writeError(rw, http.StatusUnauthorized, "unauthorized", "a valid api key is required")
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// isAdmin is whether authorization carries TODOAPP_API_KEY. With workspace keys configured that
+// is the admin key, without them the one key every client uses.
+func isAdmin(cfg config, authorization string) bool {
+	got, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && cfg.apiKey != "" && subtle.ConstantTimeCompare([]byte(got), []byte(cfg.apiKey)) == 1
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheMetrics shows up under todo_cache in GET /debug/vars
+var cacheMetrics = expvar.NewMap("todo_cache")
+
+// cacheStore wraps a todoStore and answers Get, Tree and List from an lru cache.
+//
+// Any write through the cache throws every entry away: a single write can change a lot of cached
+// answers (a delete cascades into subtasks and other todos' blockers, a completed recurring todo
+// shows up in every list), and working out which is not worth it for a todo list. To keep a read
+// that raced a write from caching what it saw before the write, entries carry the generation they
+// were read in and only go in if no write finished in between.
+//
+// Writes that don't go through this process, another instance or someone in psql, are only seen
+// once the entries expire after ttl. Keys start with the workspace, the same id or filter is a
+// different answer in every workspace.
+type cacheStore struct {
+	todoStore
+	cache *lruCache
+}
+
+func newCacheStore(s todoStore, size int, ttl time.Duration) *cacheStore {
+	return &cacheStore{todoStore: s, cache: newLRUCache(size, ttl)}
+}
+
+func (s *cacheStore) Get(ctx context.Context, id int) (todo, error) {
+	key := fmt.Sprintf("%s/get:%d", workspaceOf(ctx), id)
+	if v, ok := s.cache.get(key); ok {
+		return cloneTree(v.(todo)), nil
+	}
+
+	gen := s.cache.generation()
+	t, err := s.todoStore.Get(ctx, id)
+	if err != nil {
+		return t, err
+	}
+	s.cache.put(key, cloneTree(t), gen)
+	return t, nil
+}
+
+func (s *cacheStore) Tree(ctx context.Context, id int) (todo, error) {
+	key := fmt.Sprintf("%s/tree:%d", workspaceOf(ctx), id)
+	if v, ok := s.cache.get(key); ok {
+		return cloneTree(v.(todo)), nil
+	}
+
+	gen := s.cache.generation()
+	t, err := s.todoStore.Tree(ctx, id)
+	if err != nil {
+		return t, err
+	}
+	s.cache.put(key, cloneTree(t), gen)
+	return t, nil
+}
+
+func (s *cacheStore) List(ctx context.Context, filter todoFilter) ([]todo, error) {
+	key := workspaceOf(ctx) + "/list:" + filter.cacheKey()
+	if v, ok := s.cache.get(key); ok {
+		return cloneTodos(v.([]todo)), nil
+	}
+
+	gen := s.cache.generation()
+	todos, err := s.todoStore.List(ctx, filter)
+	if err != nil {
+		return todos, err
+	}
+	s.cache.put(key, cloneTodos(todos), gen)
+	return todos, nil
+}
+
+func (s *cacheStore) Create(ctx context.Context, t todo) (todo, error) {
+	defer s.cache.invalidate()
+	return s.todoStore.Create(ctx, t)
+}
+
+func (s *cacheStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	defer s.cache.invalidate()
+	return s.todoStore.Import(ctx, todos)
+}
+
+func (s *cacheStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	defer s.cache.invalidate()
+	return s.todoStore.Update(ctx, t)
+}
+
+func (s *cacheStore) Delete(ctx context.Context, id int) error {
+	defer s.cache.invalidate()
+	return s.todoStore.Delete(ctx, id)
+}
+
+func (s *cacheStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	defer s.cache.invalidate()
+	return s.todoStore.Complete(ctx, id)
+}
+
+func (s *cacheStore) SetParent(ctx context.Context, id, parent int) error {
+	defer s.cache.invalidate()
+	return s.todoStore.SetParent(ctx, id, parent)
+}
+
+func (s *cacheStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	defer s.cache.invalidate()
+	return s.todoStore.AddBlocker(ctx, id, blocker)
+}
+
+func (s *cacheStore) Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error {
+	defer s.cache.invalidate()
+	return s.todoStore.Restore(ctx, todos, reminders, replace)
+}
+
+func (s *cacheStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	defer s.cache.invalidate()
+	return s.todoStore.RemoveBlocker(ctx, id, blocker)
+}
+
+// cacheKey is the same for filters that List treats the same
+func (f todoFilter) cacheKey() string {
+	p := "-"
+	if f.priority != nil {
+		p = f.priority.String()
+	}
+	return fmt.Sprintf("%s|%q|%q", p, f.project, strings.Join(f.tags, "\x00"))
+}
+
+// lruCache is a size bounded map that drops the least recently used entry when it is full,
+// and treats entries older than ttl as missing
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	gen     uint64
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *lruCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok || time.Now().After(el.Value.(*lruEntry).expires) {
+		if ok {
+			c.remove(el)
+		}
+		cacheMetrics.Add("misses", 1)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	cacheMetrics.Add("hits", 1)
+	return el.Value.(*lruEntry).value, true
+}
+
+// put stores value unless the cache was invalidated since gen was handed out
+func (c *lruCache) put(key string, value any, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		cacheMetrics.Add("evictions", 1)
+	}
+}
+
+// generation is taken before reading from the store, and handed back to put
+func (c *lruCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *lruCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	clear(c.entries)
+	cacheMetrics.Add("invalidations", 1)
+}
+
+func (c *lruCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
+
+// cloneTree is cloneTodo all the way down the subtasks, so nothing a caller does to a todo
+// it got from the cache changes what the next caller gets
+func cloneTree(t todo) todo {
+	t = cloneTodo(t)
+	for i, sub := range t.subtasks {
+		t.subtasks[i] = cloneTree(sub)
+	}
+	return t
+}
+
+func cloneTodos(todos []todo) []todo {
+	if todos == nil {
+		return nil
+	}
+	out := make([]todo, len(todos))
+	for i, t := range todos {
+		out[i] = cloneTree(t)
+	}
+	return out
+}
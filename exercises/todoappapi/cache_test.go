@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race. Readers keep filling the cache while writers update and delete, and after every
+// write returns the writer has to read back what it wrote: a read that raced the write must not
+// have cached what it saw before.
+func TestCacheNoStaleReadsAfterWrites(t *testing.T) {
+	s := newCacheStore(slowReads{newMemoryStore()}, 100, time.Hour)
+	ctx := context.Background()
+
+	const writers, rounds = 4, 50
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s.List(ctx, todoFilter{})
+				s.Get(ctx, i%(writers*rounds)+1)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range rounds {
+				td, err := s.Create(ctx, todo{description: fmt.Sprintf("writer %d", w)})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				td.description = fmt.Sprintf("writer %d round %d", w, n)
+				if _, _, err := s.Update(ctx, td); err != nil {
+					t.Error(err)
+					return
+				}
+				if got, err := s.Get(ctx, td.id); err != nil || got.description != td.description {
+					t.Errorf("Get after Update: %q, %v, want %q", got.description, err, td.description)
+				}
+				if !slices.ContainsFunc(listAll(t, s), func(l todo) bool { return l.id == td.id && l.description == td.description }) {
+					t.Errorf("List after Update doesn't have %q", td.description)
+				}
+
+				if err := s.Delete(ctx, td.id); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := s.Get(ctx, td.id); !errors.Is(err, errNotFound) {
+					t.Errorf("Get after Delete: %v, want errNotFound", err)
+				}
+				if slices.ContainsFunc(listAll(t, s), func(l todo) bool { return l.id == td.id }) {
+					t.Errorf("List after Delete still has %d", td.id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+}
+
+func listAll(t *testing.T, s todoStore) []todo {
+	todos, err := s.List(context.Background(), todoFilter{})
+	if err != nil {
+		t.Error(err)
+	}
+	return todos
+}
+
+// slowReads holds on to what it read for a bit, so reads straddle the writes
+type slowReads struct{ todoStore }
+
+func (s slowReads) Get(ctx context.Context, id int) (todo, error) {
+	t, err := s.todoStore.Get(ctx, id)
+	time.Sleep(100 * time.Microsecond)
+	return t, err
+}
+
+func (s slowReads) List(ctx context.Context, filter todoFilter) ([]todo, error) {
+	todos, err := s.todoStore.List(ctx, filter)
+	time.Sleep(100 * time.Microsecond)
+	return todos, err
+}
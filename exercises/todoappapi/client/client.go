@@ -0,0 +1,188 @@
+// Package client is a typed Go client for the todo app api.
+//
+//	c, err := client.New("http://localhost:5050")
+//	todos, err := c.List(ctx, &client.ListOptions{Priority: "high"})
+//
+// Every method takes a context. Failed requests come back as *APIError, which can be
+// matched with errors.Is against ErrNotFound, ErrCycle and the other sentinels.
+// Requests are retried on network errors and 429/502/503/504 answers. POST requests carry
+// an Idempotency-Key header, so a retried Create still makes only one todo.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to one todo app api. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	apiKey     string
+	workspace  string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client in New.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http.Client, which has a 30 second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAPIKey sends key as a bearer token, for apis started with TODOAPP_API_KEY.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithWorkspace sends every request to the named workspace of the api. Without it requests go
+// to the default workspace, or to the one the api key is for.
+func WithWorkspace(name string) Option {
+	return func(c *Client) { c.workspace = name }
+}
+
+// WithRetries sets how many times a request is retried, 3 by default. 0 turns retries off.
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// WithBackoff sets the wait before the first retry, 100ms by default. It doubles on every retry after that.
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) { c.backoff = d }
+}
+
+// New returns a Client for the api at baseURL, e.g. http://localhost:5050.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base url %q has to be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retries:    3,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// do sends a request to path and decodes a successful answer into out, if out is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var (
+		payload     []byte
+		contentType = "application/json"
+	)
+	switch b := body.(type) {
+	case nil:
+	case rawBody:
+		payload, contentType = b.data, b.contentType
+	default:
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	// every attempt of a POST sends the same key, the api answers retries with the first response
+	var idempotencyKey string
+	if method == http.MethodPost {
+		idempotencyKey = rand.Text()
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		var retry bool
+		retry, err = c.send(ctx, method, u.String(), idempotencyKey, contentType, payload, out)
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// rawBody is sent as is instead of being encoded as json
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// send makes a single attempt. retry reports whether the failure is worth another try.
+func (c *Client) send(ctx context.Context, method, url, idempotencyKey, contentType string, payload []byte, out any) (retry bool, err error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.workspace != "" {
+		req.Header.Set("X-Workspace", c.workspace)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err // the context running out is final, anything else on the wire may pass
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		apiErr := decodeAPIError(res)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, apiErr
+		case http.StatusConflict:
+			// the first attempt of this request is still being handled, not a conflict in the data
+			return apiErr.Code == "idempotency_in_progress", apiErr
+		}
+		return false, apiErr
+	}
+
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("client: decoding %s %s: %w", method, url, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The tests against the real api are in the todoapp package, these are about what the client
+// does with answers the api rarely gives
+
+func TestRetryOnlyWhatIsWorthIt(t *testing.T) {
+	tests := []struct {
+		status   int
+		code     string
+		attempts int32
+	}{
+		{http.StatusTooManyRequests, "", 3},
+		{http.StatusBadGateway, "", 3},
+		{http.StatusServiceUnavailable, "", 3},
+		{http.StatusGatewayTimeout, "", 3},
+		{http.StatusConflict, "idempotency_in_progress", 3},
+		{http.StatusConflict, "cycle", 1},
+		{http.StatusBadRequest, "invalid_body", 1},
+		{http.StatusInternalServerError, "internal", 1},
+	}
+	for _, tt := range tests {
+		var attempts atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			rw.WriteHeader(tt.status)
+			rw.Write([]byte(`{"Error": {"Code": "` + tt.code + `", "Message": "no"}}`))
+		}))
+		c, _ := New(srv.URL, WithRetries(2), WithBackoff(time.Millisecond))
+
+		_, err := c.Create(context.Background(), NewTodo{Description: "x"})
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%d %s: got %v", tt.status, tt.code, err)
+		}
+		if got := attempts.Load(); got != tt.attempts {
+			t.Errorf("%d %s: %d attempts, want %d", tt.status, tt.code, got, tt.attempts)
+		}
+		srv.Close()
+	}
+}
+
+func TestRetryStopsWithTheContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c, _ := New(srv.URL, WithRetries(10), WithBackoff(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.List(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("kept waiting for the backoff after the context was done")
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	for code, want := range sentinels {
+		err := error(&APIError{StatusCode: 400, Code: code})
+		if !errors.Is(err, want) {
+			t.Errorf("%s doesn't match %v", code, want)
+		}
+	}
+	if errors.Is(&APIError{StatusCode: 500}, ErrNotFound) {
+		t.Error("an error without a code matches ErrNotFound")
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sentinel errors an *APIError matches with errors.Is, based on the code the api answered with.
+var (
+	ErrNotFound         = errors.New("todo not found")
+	ErrUnauthorized     = errors.New("missing or wrong api key")
+	ErrInvalid          = errors.New("invalid request")
+	ErrUnknownReference = errors.New("referenced todo does not exist")
+	ErrCycle            = errors.New("change would create a cycle")
+	ErrOpenSubtasks     = errors.New("todo has open subtasks")
+	ErrBlocked          = errors.New("todo is blocked by open todos")
+	ErrHasSubtasks      = errors.New("todo has subtasks, delete or move them first")
+)
+
+var sentinels = map[string]error{
+	"not_found":         ErrNotFound,
+	"unauthorized":      ErrUnauthorized,
+	"invalid_id":        ErrInvalid,
+	"invalid_body":      ErrInvalid,
+	"invalid_todo":      ErrInvalid,
+	"invalid_filter":    ErrInvalid,
+	"invalid_query":     ErrInvalid,
+	"invalid_format":    ErrInvalid,
+	"invalid_import":    ErrInvalid,
+	"validation_failed": ErrInvalid,
+	"unknown_reference": ErrUnknownReference,
+	"cycle":             ErrCycle,
+	"open_subtasks":     ErrOpenSubtasks,
+	"blocked":           ErrBlocked,
+	"has_subtasks":      ErrHasSubtasks,
+}
+
+// APIError is a non 2xx answer from the api, decoded from its {"Error": {"Code", "Message"}} envelope.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Fields     []FieldError // every invalid field of a rejected todo
+	Lines      []LineError  // what was wrong with which line of a rejected Import
+}
+
+// FieldError is one invalid field of a request. Reason is required, too_long, too_many,
+// out_of_range, malformed, wrong_type or unknown_field.
+type FieldError struct {
+	Field   string
+	Reason  string
+	Message string
+}
+
+// LineError is one bad line of an import file. For json files Line is the position in the array.
+type LineError struct {
+	Line    int
+	Message string
+	Fields  []FieldError
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("todo api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("todo api: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is lets errors.Is(err, ErrNotFound) and friends see through an *APIError.
+func (e *APIError) Is(target error) bool {
+	return sentinels[e.Code] == target
+}
+
+func decodeAPIError(res *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: res.StatusCode}
+
+	var envelope struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+		Fields []FieldError
+		Lines  []LineError
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if json.Unmarshal(body, &envelope) == nil {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Message = envelope.Error.Message
+		apiErr.Fields = envelope.Fields
+		apiErr.Lines = envelope.Lines
+	}
+	return apiErr
+}
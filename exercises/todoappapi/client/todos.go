@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Todo is a todo as the api returns it. Duedate is the zero time for todos without one.
+type Todo struct {
+	ID          int `json:"Id"`
+	Description string
+	Done        bool
+	Duedate     time.Time
+	Priority    string // none, low, medium or high
+	Tags        []string
+	Project     string
+	Recurrence  string // an RRULE like FREQ=WEEKLY;BYDAY=MO, empty for one-off todos
+	Parent      *int
+	BlockedBy   []int
+	Subtasks    []Todo `json:",omitempty"` // only filled in by GetTree
+}
+
+// NewTodo is what Create sends. Only Description is required.
+type NewTodo struct {
+	Description string
+	Done        bool     `json:",omitempty"`
+	Duedate     string   `json:",omitempty"` // RFC3339 or YYYY-MM-DD
+	Priority    string   `json:",omitempty"`
+	Tags        []string `json:",omitempty"`
+	Project     string   `json:",omitempty"`
+	Recurrence  string   `json:",omitempty"` // an RRULE subset, or daily, weekly, monthly, yearly
+	Parent      int      `json:",omitempty"`
+	BlockedBy   []int    `json:",omitempty"`
+}
+
+// ListOptions filters List. A todo has to carry every one of Tags to be listed.
+type ListOptions struct {
+	Priority string
+	Project  string
+	Tags     []string
+}
+
+// Completion is what Complete returns. Next is the follow-up of a recurring todo, nil otherwise.
+type Completion struct {
+	Todo Todo
+	Next *Todo
+}
+
+// SearchResult is one hit from Search. Snippet has the matching words wrapped in <mark></mark>.
+type SearchResult struct {
+	Todo    Todo
+	Rank    float64
+	Snippet string
+}
+
+// List returns all todos matching opts, which may be nil.
+func (c *Client) List(ctx context.Context, opts *ListOptions) ([]Todo, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Priority != "" {
+			query.Set("priority", opts.Priority)
+		}
+		if opts.Project != "" {
+			query.Set("project", opts.Project)
+		}
+		for _, tag := range opts.Tags {
+			query.Add("tag", tag)
+		}
+	}
+
+	var todos []Todo
+	err := c.do(ctx, http.MethodGet, "/todos", query, nil, &todos)
+	return todos, err
+}
+
+// Get returns a single todo.
+func (c *Client) Get(ctx context.Context, id int) (Todo, error) {
+	return c.get(ctx, id, nil)
+}
+
+// GetTree returns a todo with all of its subtasks nested in Subtasks.
+func (c *Client) GetTree(ctx context.Context, id int) (Todo, error) {
+	return c.get(ctx, id, url.Values{"nested": {"true"}})
+}
+
+func (c *Client) get(ctx context.Context, id int, query url.Values) (Todo, error) {
+	var t Todo
+	if err := c.do(ctx, http.MethodGet, todoPath(id), query, nil, &t); err != nil {
+		return Todo{}, err
+	}
+	// the api answers unknown ids with an empty object rather than a 404
+	if t.ID == 0 {
+		return Todo{}, &APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("todo %d not found", id)}
+	}
+	return t, nil
+}
+
+// Create adds a todo and returns it as stored.
+func (c *Client) Create(ctx context.Context, t NewTodo) (Todo, error) {
+	var created Todo
+	err := c.do(ctx, http.MethodPost, "/todos", nil, t, &created)
+	return created, err
+}
+
+// Delete removes a todo, which fails with ErrHasSubtasks while it has any. Deleting a todo that
+// doesn't exist is not an error.
+func (c *Client) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, todoPath(id), nil, nil, nil)
+}
+
+// Complete marks a todo done. It fails with ErrOpenSubtasks or ErrBlocked while other todos are in the way.
+func (c *Client) Complete(ctx context.Context, id int) (Completion, error) {
+	var done Completion
+	err := c.do(ctx, http.MethodPost, todoPath(id)+"/done", nil, nil, &done)
+	return done, err
+}
+
+// SetParent makes id a subtask of parent.
+func (c *Client) SetParent(ctx context.Context, id, parent int) (Todo, error) {
+	return c.relation(ctx, http.MethodPut, todoPath(id)+"/parent/"+strconv.Itoa(parent))
+}
+
+// ClearParent turns a subtask back into a top level todo.
+func (c *Client) ClearParent(ctx context.Context, id int) (Todo, error) {
+	return c.relation(ctx, http.MethodDelete, todoPath(id)+"/parent")
+}
+
+// AddBlocker means id cannot be completed before blocker is.
+func (c *Client) AddBlocker(ctx context.Context, id, blocker int) (Todo, error) {
+	return c.relation(ctx, http.MethodPut, todoPath(id)+"/blockers/"+strconv.Itoa(blocker))
+}
+
+// RemoveBlocker undoes AddBlocker.
+func (c *Client) RemoveBlocker(ctx context.Context, id, blocker int) (Todo, error) {
+	return c.relation(ctx, http.MethodDelete, todoPath(id)+"/blockers/"+strconv.Itoa(blocker))
+}
+
+func (c *Client) relation(ctx context.Context, method, path string) (Todo, error) {
+	var t Todo
+	err := c.do(ctx, method, path, nil, nil, &t)
+	return t, err
+}
+
+// Search returns up to limit todos whose description matches q, best match first.
+// A limit of 0 leaves it to the api.
+func (c *Client) Search(ctx context.Context, q string, limit int) ([]SearchResult, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var results []SearchResult
+	err := c.do(ctx, http.MethodGet, "/todos/search", query, nil, &results)
+	return results, err
+}
+
+// ImportResult is what Import returns. With a dry run, Todos are what would have been created
+// and have no ids yet.
+type ImportResult struct {
+	DryRun   bool
+	Imported int
+	Todos    []Todo
+}
+
+// Import sends a csv, json or todotxt file to be created in one go. Either every todo in it
+// is created or none is, an *APIError lists the bad lines in Lines.
+func (c *Client) Import(ctx context.Context, format string, data []byte, dryRun bool) (ImportResult, error) {
+	contentType := map[string]string{"csv": "text/csv", "json": "application/json", "todotxt": "text/plain"}[format]
+	if contentType == "" {
+		return ImportResult{}, fmt.Errorf("client: unknown import format %q, expected csv, json or todotxt", format)
+	}
+	query := url.Values{"format": {format}, "dry_run": {strconv.FormatBool(dryRun)}}
+
+	var res ImportResult
+	err := c.do(ctx, http.MethodPost, "/todos/import", query, rawBody{contentType: contentType, data: data}, &res)
+	return res, err
+}
+
+func todoPath(id int) string {
+	return "/todos/" + strconv.Itoa(id)
+}
+
+// Stats is what GetStats returns. CompletedByWeek is oldest week first, AverageSecondsToDone
+// is nil until a todo has been completed.
+type Stats struct {
+	Total                int
+	Open                 int
+	Done                 int
+	Overdue              int
+	CompletedByWeek      []WeekCount
+	AverageSecondsToDone *float64
+}
+
+// WeekCount is how many todos were completed in the week starting on Monday Week (YYYY-MM-DD).
+type WeekCount struct {
+	Week      string
+	Completed int
+}
+
+// GetStats counts todos by status, with completions for the last weeks weeks.
+// A weeks of 0 leaves it to the api.
+func (c *Client) GetStats(ctx context.Context, weeks int) (Stats, error) {
+	var query url.Values
+	if weeks > 0 {
+		query = url.Values{"weeks": {strconv.Itoa(weeks)}}
+	}
+
+	var s Stats
+	err := c.do(ctx, http.MethodGet, "/todos/stats", query, nil, &s)
+	return s, err
+}
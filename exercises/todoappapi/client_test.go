@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	todoclient "github.com/jb-start-here/golang-start-here/exercises/todoapp/client"
+)
+
+// startTestAPI serves the REST api the way main does, on a memory store, and points the
+// package level store at it for the length of the test. wrap, when set, goes around the
+// whole handler.
+func startTestAPI(t *testing.T, cfg config, wrap func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+	tracer := newTracer(discardExporter{})
+	setupStore(cfg, newMemoryStore(), tracer)
+	handler := newHandler(cfg, tracer)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testConfig is the default config, whatever TODOAPP_* is set in the environment
+func testConfig() config {
+	cfg := loadConfig()
+	cfg.store = "memory"
+	cfg.apiKey = ""
+	cfg.workspaceKeys = nil
+	cfg.cors.origins = nil
+	return cfg
+}
+
+func newTestClient(t *testing.T, url string, opts ...todoclient.Option) *todoclient.Client {
+	t.Helper()
+	c, err := todoclient.New(url, append([]todoclient.Option{todoclient.WithBackoff(time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	c := newTestClient(t, srv.URL)
+	ctx := context.Background()
+
+	create := func(nt todoclient.NewTodo) todoclient.Todo {
+		t.Helper()
+		created, err := c.Create(ctx, nt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	parent := create(todoclient.NewTodo{Description: "parent"})
+	child := create(todoclient.NewTodo{Description: "child", Parent: parent.ID})
+	blocker := create(todoclient.NewTodo{Description: "blocker"})
+	blocked := create(todoclient.NewTodo{Description: "blocked", BlockedBy: []int{blocker.ID}})
+
+	_, err := c.Get(ctx, 999)
+	expectErr(t, "Get of an unknown id", err, todoclient.ErrNotFound)
+	_, err = c.Complete(ctx, 999)
+	expectErr(t, "Complete of an unknown id", err, todoclient.ErrNotFound)
+	_, err = c.SetParent(ctx, parent.ID, child.ID)
+	expectErr(t, "SetParent under its own subtask", err, todoclient.ErrCycle)
+	_, err = c.AddBlocker(ctx, blocker.ID, blocked.ID)
+	expectErr(t, "AddBlocker the other way round", err, todoclient.ErrCycle)
+	_, err = c.Complete(ctx, blocked.ID)
+	expectErr(t, "Complete while blocked", err, todoclient.ErrBlocked)
+	_, err = c.Complete(ctx, parent.ID)
+	expectErr(t, "Complete with an open subtask", err, todoclient.ErrOpenSubtasks)
+	expectErr(t, "Delete with a subtask", c.Delete(ctx, parent.ID), todoclient.ErrHasSubtasks)
+	_, err = c.Create(ctx, todoclient.NewTodo{Description: "orphan", Parent: 999})
+	expectErr(t, "Create under an unknown parent", err, todoclient.ErrUnknownReference)
+	_, err = c.Create(ctx, todoclient.NewTodo{})
+	expectErr(t, "Create without a description", err, todoclient.ErrInvalid)
+
+	var apiErr *todoclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || len(apiErr.Fields) == 0 {
+		t.Errorf("Create without a description: got %#v, want a 422 with field errors", err)
+	}
+}
+
+// flaky answers the first fails requests with a 503 after letting them through to next, the
+// way a proxy does when the api is slow to answer. It keeps the Idempotency-Key of every request.
+type flaky struct {
+	next  http.Handler
+	fails int
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func (f *flaky) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.keys = append(f.keys, r.Header.Get("Idempotency-Key"))
+	fail := len(f.keys) <= f.fails
+	f.mu.Unlock()
+
+	if !fail {
+		f.next.ServeHTTP(rw, r)
+		return
+	}
+	f.next.ServeHTTP(httptest.NewRecorder(), r) // done, but the answer never arrives
+	http.Error(rw, "upstream timed out", http.StatusServiceUnavailable)
+}
+
+func TestClientRetriesWithOneIdempotencyKey(t *testing.T) {
+	f := &flaky{fails: 2}
+	srv := startTestAPI(t, testConfig(), func(next http.Handler) http.Handler {
+		f.next = next
+		return f
+	})
+	c := newTestClient(t, srv.URL)
+	ctx := context.Background()
+
+	created, err := c.Create(ctx, todoclient.NewTodo{Description: "only once"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.keys) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(f.keys))
+	}
+	if f.keys[0] == "" || f.keys[1] != f.keys[0] || f.keys[2] != f.keys[0] {
+		t.Errorf("Idempotency-Key changed between retries: %q", f.keys)
+	}
+
+	todos, err := c.List(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 || todos[0].ID != created.ID {
+		t.Errorf("three attempts made %d todos, want the one that came back: %+v", len(todos), todos)
+	}
+}
+
+func TestClientGivesUpAfterRetries(t *testing.T) {
+	f := &flaky{fails: 10}
+	srv := startTestAPI(t, testConfig(), func(next http.Handler) http.Handler {
+		f.next = next
+		return f
+	})
+	c := newTestClient(t, srv.URL, todoclient.WithRetries(2))
+
+	_, err := c.List(context.Background(), nil)
+	var apiErr *todoclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got %v, want the last 503", err)
+	}
+	if len(f.keys) != 3 {
+		t.Errorf("sent %d requests, want 1 and 2 retries", len(f.keys))
+	}
+	if f.keys[0] != "" {
+		t.Errorf("a GET carried Idempotency-Key %q", f.keys[0])
+	}
+}
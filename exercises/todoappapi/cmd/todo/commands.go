@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/client"
+)
+
+func list(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	fs := newFlagSet("list")
+	opts := client.ListOptions{}
+	fs.StringVar(&opts.Priority, "priority", "", "only todos with this priority")
+	fs.StringVar(&opts.Project, "project", "", "only todos in this project")
+	fs.Var((*stringList)(&opts.Tags), "tag", "only todos with this tag, repeatable")
+	format := outputFlag(fs)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	todos, err := c.List(ctx, &opts)
+	if err != nil {
+		return err
+	}
+	return printTodos(out, *format, todos)
+}
+
+func show(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	fs := newFlagSet("show")
+	tree := fs.Bool("tree", false, "include subtasks")
+	format := outputFlag(fs)
+	ids, err := parseIDs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var t client.Todo
+	if *tree {
+		t, err = c.GetTree(ctx, ids[0])
+	} else {
+		t, err = c.Get(ctx, ids[0])
+	}
+	if err != nil {
+		return err
+	}
+	return printTodo(out, *format, t)
+}
+
+func add(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	fs := newFlagSet("add")
+	var t client.NewTodo
+	fs.StringVar(&t.Duedate, "due", "", "duedate, YYYY-MM-DD")
+	fs.StringVar(&t.Priority, "priority", "", "none, low, medium or high")
+	fs.Var((*stringList)(&t.Tags), "tag", "tag, repeatable")
+	fs.StringVar(&t.Project, "project", "", "project name")
+	fs.StringVar(&t.Recurrence, "recur", "", "daily, weekly, monthly, yearly or an RRULE")
+	fs.IntVar(&t.Parent, "parent", 0, "make it a subtask of this todo")
+	format := outputFlag(fs)
+	words, err := parseArgs(fs, args, -1)
+	if err != nil {
+		return err
+	}
+	t.Description = strings.Join(words, " ")
+
+	created, err := c.Create(ctx, t)
+	if err != nil {
+		return err
+	}
+	return printTodo(out, *format, created)
+}
+
+func done(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	fs := newFlagSet("done")
+	format := outputFlag(fs)
+	ids, err := parseIDs(fs, args, -1)
+	if err != nil {
+		return err
+	}
+
+	var todos []client.Todo
+	for _, id := range ids {
+		completion, err := c.Complete(ctx, id)
+		if err != nil {
+			return fmt.Errorf("todo %d: %w", id, err)
+		}
+		todos = append(todos, completion.Todo)
+		if completion.Next != nil {
+			todos = append(todos, *completion.Next)
+		}
+	}
+	return printTodos(out, *format, todos)
+}
+
+func remove(ctx context.Context, c *client.Client, args []string, _ io.Writer) error {
+	ids, err := parseIDs(newFlagSet("rm"), args, -1)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := c.Delete(ctx, id); err != nil {
+			return fmt.Errorf("todo %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func export(ctx context.Context, c *client.Client, args []string, out io.Writer) (err error) {
+	fs := newFlagSet("export")
+	format := fs.String("format", "json", "json or csv")
+	path := fs.String("out", "", "write to this file instead of stdout")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown export format %q, expected json or csv", *format)
+	}
+
+	todos, err := c.List(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if *path != "" {
+		f, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = f
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(todos)
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"id", "description", "done", "duedate", "priority", "project", "tags", "recurrence", "parent", "blocked_by"})
+	for _, t := range todos {
+		parent := ""
+		if t.Parent != nil {
+			parent = strconv.Itoa(*t.Parent)
+		}
+		w.Write([]string{
+			strconv.Itoa(t.ID), t.Description, strconv.FormatBool(t.Done), formatDue(t), t.Priority, t.Project,
+			strings.Join(t.Tags, ";"), t.Recurrence, parent, joinIDs(t.BlockedBy, ";"),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func importFile(ctx context.Context, c *client.Client, args []string, out io.Writer) error {
+	fs := newFlagSet("import")
+	format := fs.String("format", "", "csv, json or todotxt, guessed from the file extension when left out")
+	dryRun := fs.Bool("dry-run", false, "only check the file, don't create anything")
+	output := outputFlag(fs)
+	paths, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path := paths[0]
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".json":
+			*format = "json"
+		case ".txt":
+			*format = "todotxt"
+		default:
+			return fmt.Errorf("cannot tell the format of %q, pass --format", path)
+		}
+	}
+
+	var data []byte
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := c.Import(ctx, *format, data, *dryRun)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && len(apiErr.Lines) > 0 {
+		var msg strings.Builder
+		msg.WriteString(apiErr.Message)
+		for _, l := range apiErr.Lines {
+			fmt.Fprintf(&msg, "\n  %s:%d: %s", path, l.Line, l.Message)
+		}
+		return errors.New(msg.String())
+	}
+	if err != nil {
+		return err
+	}
+	return printTodos(out, *output, res.Todos)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", "table", "output format, table or json")
+}
+
+// parseArgs is fs.Parse that also accepts flags after positional arguments,
+// so `todo add buy milk --due 2024-06-01` works. want is the number of positional
+// arguments expected, -1 for at least one.
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	switch {
+	case want < 0 && len(positional) == 0:
+		return nil, fmt.Errorf("%s needs at least one argument", fs.Name())
+	case want >= 0 && len(positional) != want:
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", fs.Name(), want, len(positional))
+	}
+	return positional, nil
+}
+
+func parseIDs(fs *flag.FlagSet, args []string, want int) ([]int, error) {
+	positional, err := parseArgs(fs, args, want)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(positional))
+	for i, raw := range positional {
+		if ids[i], err = strconv.Atoi(raw); err != nil {
+			return nil, fmt.Errorf("%q is not a todo id", raw)
+		}
+	}
+	return ids, nil
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
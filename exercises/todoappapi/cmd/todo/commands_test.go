@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/client"
+)
+
+// The api's side of an import is tested in the todoapp package, this is about what the
+// command sends and how it reports a rejected file
+
+func TestImportFile(t *testing.T) {
+	var got struct{ query, contentType, body string }
+	var answer string
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.query, got.contentType, got.body = r.URL.RawQuery, r.Header.Get("Content-Type"), string(body)
+		rw.WriteHeader(status)
+		io.WriteString(rw, answer)
+	}))
+	defer srv.Close()
+	c, err := client.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	csv := write("todos.csv", "description\nbuy milk\n")
+	txt := write("todos.txt", "(A) buy milk\n")
+	odd := write("todos.xlsx", "")
+
+	status, answer = http.StatusOK, `{"DryRun": true, "Imported": 1, "Todos": [{"Id": 1, "Description": "buy milk", "Priority": "none"}]}`
+	var out strings.Builder
+	if err := importFile(context.Background(), c, []string{csv, "--dry-run"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got.query != "dry_run=true&format=csv" || got.contentType != "text/csv" || got.body != "description\nbuy milk\n" {
+		t.Errorf("sent %+v", got)
+	}
+	if !strings.Contains(out.String(), "buy milk") {
+		t.Errorf("printed %q", out.String())
+	}
+
+	if err := importFile(context.Background(), c, []string{"--format", "json", txt}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got.query != "dry_run=false&format=json" || got.contentType != "application/json" {
+		t.Errorf("--format json sent %+v", got)
+	}
+
+	if err := importFile(context.Background(), c, []string{odd}, io.Discard); err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("an unknown extension: %v", err)
+	}
+
+	status, answer = http.StatusUnprocessableEntity, `{"Error": {"Code": "invalid_import", "Message": "2 of 3 todos are invalid, nothing was imported"},
+		"Lines": [{"Line": 2, "Message": "Description is required"}, {"Line": 3, "Message": "done \"maybe\" is not true or false"}]}`
+	err = importFile(context.Background(), c, []string{txt}, io.Discard)
+	want := "2 of 3 todos are invalid, nothing was imported\n  " + txt + ":2: Description is required\n  " + txt + `:3: done "maybe" is not true or false`
+	if err == nil || err.Error() != want {
+		t.Errorf("a rejected file: got %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Completion covers commands, flags and the fixed flag values. Ids are left alone,
+// completing them would mean calling the api on every tab.
+
+const bashCompletion = `# eval "$(todo completion bash)"
+_todo() {
+	local cur prev cmd
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+	cmd="${COMP_WORDS[1]}"
+
+	case "$prev" in
+		--priority) COMPREPLY=($(compgen -W "none low medium high" -- "$cur")); return ;;
+		-o) COMPREPLY=($(compgen -W "table json" -- "$cur")); return ;;
+		--format) COMPREPLY=($(compgen -W "json csv todotxt" -- "$cur")); return ;;
+		--recur) COMPREPLY=($(compgen -W "daily weekly monthly yearly" -- "$cur")); return ;;
+		--out) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+	esac
+
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "list show add done rm export import completion help --url --api-key --workspace" -- "$cur"))
+		return
+	fi
+
+	case "$cmd" in
+		list|ls) COMPREPLY=($(compgen -W "--priority --project --tag -o" -- "$cur")) ;;
+		show) COMPREPLY=($(compgen -W "--tree -o" -- "$cur")) ;;
+		add) COMPREPLY=($(compgen -W "--due --priority --tag --project --recur --parent -o" -- "$cur")) ;;
+		done) COMPREPLY=($(compgen -W "-o" -- "$cur")) ;;
+		export) COMPREPLY=($(compgen -W "--format --out" -- "$cur")) ;;
+		import) COMPREPLY=($(compgen -W "--format --dry-run -o" -- "$cur") $(compgen -f -- "$cur")) ;;
+		completion) COMPREPLY=($(compgen -W "bash zsh" -- "$cur")) ;;
+	esac
+}
+complete -F _todo todo
+`
+
+const zshCompletion = `#compdef todo
+# todo completion zsh > "${fpath[1]}/_todo"
+_todo() {
+	local -a commands
+	commands=(
+		'list:list todos'
+		'show:show a todo'
+		'add:add a todo'
+		'done:mark todos done'
+		'rm:delete todos'
+		'export:export every todo'
+		'import:import todos from a csv, json or todo.txt file'
+		'completion:print a completion script'
+		'help:show usage'
+	)
+
+	_arguments -C \
+		'--url[api base url]:url:' \
+		'--api-key[api key]:key:' \
+		'--workspace[workspace]:name:' \
+		'1:command:->command' \
+		'*::arg:->args'
+
+	case $state in
+		command) _describe 'command' commands ;;
+		args)
+			case $words[1] in
+				list|ls) _arguments '--priority[priority]:priority:(none low medium high)' '--project[project]:project:' '*--tag[tag]:tag:' '-o[output]:format:(table json)' ;;
+				show) _arguments '--tree[include subtasks]' '-o[output]:format:(table json)' '1:id:' ;;
+				add) _arguments '--due[duedate]:date:' '--priority[priority]:priority:(none low medium high)' '*--tag[tag]:tag:' '--project[project]:project:' '--recur[recurrence]:rule:(daily weekly monthly yearly)' '--parent[parent id]:id:' '-o[output]:format:(table json)' '*:description:' ;;
+				done) _arguments '-o[output]:format:(table json)' '*:id:' ;;
+				export) _arguments '--format[format]:format:(json csv)' '--out[file]:file:_files' ;;
+				import) _arguments '--format[format]:format:(csv json todotxt)' '--dry-run[only validate]' '-o[output]:format:(table json)' '1:file:_files' ;;
+				completion) _arguments '1:shell:(bash zsh)' ;;
+			esac
+			;;
+	esac
+}
+_todo "$@"
+`
+
+func completion(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	switch args[0] {
+	case "bash":
+		_, err := io.WriteString(out, bashCompletion)
+		return err
+	case "zsh":
+		_, err := io.WriteString(out, zshCompletion)
+		return err
+	}
+	return fmt.Errorf("no completion for %q, expected bash or zsh", args[0])
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type config struct {
+	URL       string `json:"url"`
+	APIKey    string `json:"api_key"`
+	Workspace string `json:"workspace"`
+}
+
+// loadConfig layers the config file, then TODO_URL / TODO_API_KEY / TODO_WORKSPACE, then the flags
+// on top of each other
+func loadConfig(urlFlag, apiKeyFlag, workspaceFlag string) (config, error) {
+	cfg := config{URL: "http://localhost:5050"}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		body, err := os.ReadFile(filepath.Join(dir, "todo", "config.json"))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return config{}, err
+		default:
+			if err := json.Unmarshal(body, &cfg); err != nil {
+				return config{}, err
+			}
+		}
+	}
+
+	layers := []config{
+		{os.Getenv("TODO_URL"), os.Getenv("TODO_API_KEY"), os.Getenv("TODO_WORKSPACE")},
+		{urlFlag, apiKeyFlag, workspaceFlag},
+	}
+	for _, layer := range layers {
+		if layer.URL != "" {
+			cfg.URL = layer.URL
+		}
+		if layer.APIKey != "" {
+			cfg.APIKey = layer.APIKey
+		}
+		if layer.Workspace != "" {
+			cfg.Workspace = layer.Workspace
+		}
+	}
+	return cfg, nil
+}
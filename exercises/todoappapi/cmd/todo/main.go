@@ -0,0 +1,107 @@
+// Command todo is a command line client for the todo app api.
+//
+//	todo list --priority high
+//	todo add "water the plants" --due 2024-06-01 --tag home --recur weekly
+//	todo done 3
+//
+// Run `todo help` for everything else.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/client"
+)
+
+const usage = `usage: todo [--url URL] [--api-key KEY] [--workspace NAME] <command> [arguments]
+
+commands:
+  list                  list todos (--priority, --project, --tag)
+  show <id>             show a todo (--tree for its subtasks too)
+  add <description>     add a todo (--due, --priority, --tag, --project, --recur, --parent)
+  done <id>...          mark todos done
+  rm <id>...            delete todos
+  export                write every todo to stdout or --out as json or csv (--format)
+  import <file>         add every todo in a csv, json or todo.txt file, - for stdin (--format, --dry-run)
+  completion <shell>    print a bash or zsh completion script
+
+list, show, add, done and import print a table, or json with -o json.
+
+The api url, key and workspace come from --url, --api-key and --workspace, then TODO_URL,
+TODO_API_KEY and TODO_WORKSPACE, then the "url", "api_key" and "workspace" keys of
+` + "`~/.config/todo/config.json`" + `.
+`
+
+// errUsage makes main print the usage and exit with 2, like flag does
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "todo:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	global := flag.NewFlagSet("todo", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	url := global.String("url", "", "api base url")
+	apiKey := global.String("api-key", "", "api key")
+	workspace := global.String("workspace", "", "workspace")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		return errUsage
+	}
+	command, args := global.Arg(0), global.Args()[1:]
+
+	// completion and help don't need an api
+	switch command {
+	case "help":
+		fmt.Fprint(out, usage)
+		return nil
+	case "completion":
+		return completion(args, out)
+	}
+
+	cfg, err := loadConfig(*url, *apiKey, *workspace)
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg.URL, client.WithAPIKey(cfg.APIKey), client.WithWorkspace(cfg.Workspace))
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "list", "ls":
+		return list(ctx, c, args, out)
+	case "show":
+		return show(ctx, c, args, out)
+	case "add":
+		return add(ctx, c, args, out)
+	case "done":
+		return done(ctx, c, args, out)
+	case "rm":
+		return remove(ctx, c, args, out)
+	case "export":
+		return export(ctx, c, args, out)
+	case "import":
+		return importFile(ctx, c, args, out)
+	}
+	return fmt.Errorf("unknown command %q, see todo help", command)
+}
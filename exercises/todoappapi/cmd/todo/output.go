@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/client"
+)
+
+func printTodos(out io.Writer, format string, todos []client.Todo) error {
+	switch format {
+	case "json":
+		if todos == nil {
+			todos = []client.Todo{}
+		}
+		return printJSON(out, todos)
+	case "table":
+		w := tableWriter(out)
+		for _, t := range todos {
+			printRow(w, t, 0)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %q, expected table or json", format)
+}
+
+// printTodo is printTodos for a single todo, subtasks are indented under their parent
+func printTodo(out io.Writer, format string, t client.Todo) error {
+	switch format {
+	case "json":
+		return printJSON(out, t)
+	case "table":
+		w := tableWriter(out)
+		var walk func(t client.Todo, depth int)
+		walk = func(t client.Todo, depth int) {
+			printRow(w, t, depth)
+			for _, sub := range t.Subtasks {
+				walk(sub, depth+1)
+			}
+		}
+		walk(t, 0)
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %q, expected table or json", format)
+}
+
+func printJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+func tableWriter(out io.Writer) *tabwriter.Writer {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDONE\tDUE\tPRIORITY\tPROJECT\tTAGS\tDESCRIPTION")
+	return w
+}
+
+func printRow(w io.Writer, t client.Todo, depth int) {
+	done := "[ ]"
+	if t.Done {
+		done = "[x]"
+	}
+	description := strings.Repeat("  ", depth) + t.Description
+	if t.Recurrence != "" {
+		description += " (" + t.Recurrence + ")"
+	}
+	if len(t.BlockedBy) > 0 {
+		description += " (blocked by " + joinIDs(t.BlockedBy, ", ") + ")"
+	}
+	fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, done, formatDue(t), t.Priority, t.Project, strings.Join(t.Tags, ","), description)
+}
+
+func formatDue(t client.Todo) string {
+	if t.Duedate.IsZero() {
+		return ""
+	}
+	return t.Duedate.Format("2006-01-02")
+}
+
+func joinIDs(ids []int, sep string) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, sep)
+}
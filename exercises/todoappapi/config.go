@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is read from TODOAPP_* environment variables, anything unset keeps its default
+type config struct {
+	store              string        // postgres, sqlite or memory
+	apiKey             string        // when set, requests need an "Authorization: Bearer <apiKey>" header
+	workspaceKeys      workspaceKeys // one api key per workspace, see workspace.go
+	openWorkspaces     bool          // let requests without any api key pick a workspace by header
+	archiveReplace     bool          // let anyone PUT /todos/archive?replace=true, not only the admin key
+	grpcAddr           string        // where the grpc TodoService listens, empty turns it off
+	idempotencyWindow  time.Duration // how long answers to requests with an Idempotency-Key are kept, 0 turns it off
+	cors               corsConfig    // no origins turns cors off
+	tls                tlsConfig     // no certificate serves plain http
+	traceExporter      string        // where finished spans go: none or stdout
+	sqlitePath         string        // database file for the sqlite store, created if missing
+	postgresRLS        bool          // have postgres enforce the workspaces with row level security too
+	pool               poolConfig    // connection pool of the postgres and sqlite stores
+	cacheSize          int           // how many reads the cache in front of the store keeps, 0 turns it off
+	cacheTTL           time.Duration // how long a cached read is served before asking the store again
+	reminderInterval   time.Duration // how often the scheduler looks for due todos, 0 turns reminders off
+	reminderLead       time.Duration // how far ahead of the duedate the "upcoming" reminder goes out
+	reminderNotifier   string        // log, webhook or smtp
+	reminderWebhookURL string
+	reminderSMTPAddr   string
+	reminderSMTPFrom   string
+	reminderSMTPTo     string
+}
+
+func loadConfig() config {
+	return config{
+		store:      envString("TODOAPP_STORE", "postgres"),
+		sqlitePath: envString("TODOAPP_SQLITE_PATH", "todos.db"),
+		pool: poolConfig{
+			maxOpenConns:    envInt("TODOAPP_DB_MAX_OPEN_CONNS", 20),
+			maxIdleConns:    envInt("TODOAPP_DB_MAX_IDLE_CONNS", 10),
+			connMaxLifetime: envDuration("TODOAPP_DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			connMaxIdleTime: envDuration("TODOAPP_DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		},
+		traceExporter:     envString("TODOAPP_TRACE_EXPORTER", "none"),
+		postgresRLS:       envBool("TODOAPP_POSTGRES_RLS", false),
+		cacheSize:         envInt("TODOAPP_CACHE_SIZE", 1000),
+		cacheTTL:          envDuration("TODOAPP_CACHE_TTL", 30*time.Second),
+		apiKey:            envString("TODOAPP_API_KEY", ""),
+		workspaceKeys:     parseWorkspaceKeys(envList("TODOAPP_WORKSPACE_KEYS", nil)),
+		openWorkspaces:    envBool("TODOAPP_OPEN_WORKSPACES", false),
+		archiveReplace:    envBool("TODOAPP_ARCHIVE_REPLACE", false),
+		grpcAddr:          envString("TODOAPP_GRPC_ADDR", ":5051"),
+		idempotencyWindow: envDuration("TODOAPP_IDEMPOTENCY_WINDOW", 24*time.Hour),
+		cors: corsConfig{
+			origins:     envList("TODOAPP_CORS_ORIGINS", nil),
+			methods:     envList("TODOAPP_CORS_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+			headers:     envList("TODOAPP_CORS_HEADERS", []string{"Authorization", "Content-Type", "Idempotency-Key", "X-Workspace"}),
+			credentials: envBool("TODOAPP_CORS_CREDENTIALS", false),
+			maxAge:      envDuration("TODOAPP_CORS_MAX_AGE", 10*time.Minute),
+		},
+		tls: tlsConfig{
+			certFile:       envString("TODOAPP_TLS_CERT", ""),
+			keyFile:        envString("TODOAPP_TLS_KEY", ""),
+			clientCAFile:   envString("TODOAPP_TLS_CLIENT_CA", ""),
+			reloadInterval: envDuration("TODOAPP_TLS_RELOAD_INTERVAL", 10*time.Second),
+		},
+		reminderInterval:   envDuration("TODOAPP_REMINDER_INTERVAL", time.Minute),
+		reminderLead:       envDuration("TODOAPP_REMINDER_LEAD", 24*time.Hour),
+		reminderNotifier:   envString("TODOAPP_REMINDER_NOTIFIER", "log"),
+		reminderWebhookURL: envString("TODOAPP_REMINDER_WEBHOOK_URL", ""),
+		reminderSMTPAddr:   envString("TODOAPP_REMINDER_SMTP_ADDR", "localhost:1025"),
+		reminderSMTPFrom:   envString("TODOAPP_REMINDER_SMTP_FROM", "todos@localhost"),
+		reminderSMTPTo:     envString("TODOAPP_REMINDER_SMTP_TO", ""),
+	}
+}
+
+func envString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+// envList splits a comma separated variable, "a, b" is a and b
+func envList(key string, fallback []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envBool(key string, fallback bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return b
+}
+
+func envInt(key string, fallback int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return d
+}
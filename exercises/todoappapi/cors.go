@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsConfig is which other origins may call the api from a browser, see TODOAPP_CORS_* in config.go
+type corsConfig struct {
+	origins     []string // "*" allows any origin
+	methods     []string
+	headers     []string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// headers the browser lets scripts read on top of the basic ones
+var corsExposedHeaders = strings.Join([]string{"Location", "Idempotent-Replayed", "WWW-Authenticate"}, ", ")
+
+// cors wraps the whole router rather than going in with router.Use, because mux only runs
+// middlewares for matched routes and no route takes OPTIONS. Preflights are answered here,
+// before the api key check: browsers never send credentials with them.
+func cors(cfg corsConfig, next http.Handler) http.Handler {
+	methods := strings.Join(cfg.methods, ", ")
+	maxAge := strconv.Itoa(int(cfg.maxAge.Seconds()))
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		rw.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin == "" || !cfg.allowsOrigin(origin) {
+			if preflight {
+				rw.WriteHeader(http.StatusNoContent) // no allow headers, the browser blocks the real request
+				return
+			}
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		allowOrigin := origin
+		if !cfg.credentials && slices.Contains(cfg.origins, "*") {
+			allowOrigin = "*"
+		}
+
+		if !preflight {
+			rw.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			rw.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			if cfg.credentials {
+				rw.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		rw.Header().Add("Vary", "Access-Control-Request-Method")
+		rw.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !cfg.allowsMethod(r.Header.Get("Access-Control-Request-Method")) || !cfg.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		rw.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		rw.Header().Set("Access-Control-Allow-Methods", methods)
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			rw.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+		if cfg.credentials {
+			rw.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if cfg.maxAge > 0 {
+			rw.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c corsConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c corsConfig) allowsMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost: // simple methods are always allowed
+		return true
+	}
+	return slices.Contains(c.methods, method)
+}
+
+// allowsHeaders checks every header in a comma separated Access-Control-Request-Headers
+func (c corsConfig) allowsHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !slices.ContainsFunc(c.headers, func(allowed string) bool { return strings.EqualFold(allowed, h) }) {
+			return false
+		}
+	}
+	return true
+}
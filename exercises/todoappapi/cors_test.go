@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	site := corsConfig{
+		origins: []string{"https://app.example"},
+		methods: []string{"GET", "POST", "PUT", "DELETE"},
+		headers: []string{"Content-Type", "X-Workspace"},
+		maxAge:  10 * time.Minute,
+	}
+	anyone := site
+	anyone.origins = []string{"*"}
+	withCookies := anyone
+	withCookies.credentials = true
+	noMaxAge := site
+	noMaxAge.maxAge = 0
+
+	const (
+		allowOrigin  = "Access-Control-Allow-Origin"
+		allowMethods = "Access-Control-Allow-Methods"
+		allowHeaders = "Access-Control-Allow-Headers"
+		allowCreds   = "Access-Control-Allow-Credentials"
+		maxAge       = "Access-Control-Max-Age"
+		expose       = "Access-Control-Expose-Headers"
+	)
+	preflightVary := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+
+	tests := []struct {
+		name    string
+		cfg     corsConfig
+		method  string
+		header  map[string]string
+		status  int
+		reached bool
+		want    map[string]string // an empty value means the header must be missing
+		vary    []string
+	}{
+		{"allowed origin", site, "GET", map[string]string{"Origin": "https://app.example"},
+			200, true, map[string]string{allowOrigin: "https://app.example", expose: corsExposedHeaders, allowCreds: ""}, []string{"Origin"}},
+		{"other origin", site, "GET", map[string]string{"Origin": "https://evil.example"},
+			200, true, map[string]string{allowOrigin: "", expose: ""}, []string{"Origin"}},
+		{"no origin", site, "GET", nil, 200, true, map[string]string{allowOrigin: ""}, []string{"Origin"}},
+		{"preflight", site, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "content-type, x-workspace"},
+			204, false, map[string]string{allowOrigin: "https://app.example", allowMethods: "GET, POST, PUT, DELETE", allowHeaders: "content-type, x-workspace", maxAge: "600", allowCreds: ""}, preflightVary},
+		{"preflight from another origin", site, "OPTIONS", map[string]string{"Origin": "https://evil.example", "Access-Control-Request-Method": "PUT"},
+			204, false, map[string]string{allowOrigin: "", allowMethods: ""}, []string{"Origin"}},
+		{"preflight for a method not allowed", site, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "PATCH"},
+			204, false, map[string]string{allowOrigin: "", allowMethods: "", maxAge: ""}, preflightVary},
+		{"preflight for a header not allowed", site, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "Content-Type, X-Secret"},
+			204, false, map[string]string{allowOrigin: "", allowHeaders: ""}, preflightVary},
+		{"preflight for a simple method", site, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "POST"},
+			204, false, map[string]string{allowOrigin: "https://app.example", allowHeaders: ""}, preflightVary},
+		{"preflight without max age", noMaxAge, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "PUT"},
+			204, false, map[string]string{allowOrigin: "https://app.example", maxAge: ""}, preflightVary},
+		{"any origin", anyone, "GET", map[string]string{"Origin": "https://app.example"},
+			200, true, map[string]string{allowOrigin: "*", allowCreds: ""}, []string{"Origin"}},
+		{"any origin with credentials echoes it", withCookies, "GET", map[string]string{"Origin": "https://app.example"},
+			200, true, map[string]string{allowOrigin: "https://app.example", allowCreds: "true"}, []string{"Origin"}},
+		{"preflight for any origin with credentials", withCookies, "OPTIONS", map[string]string{"Origin": "https://app.example", "Access-Control-Request-Method": "DELETE"},
+			204, false, map[string]string{allowOrigin: "https://app.example", allowCreds: "true"}, preflightVary},
+		{"OPTIONS that isn't a preflight", site, "OPTIONS", map[string]string{"Origin": "https://app.example"},
+			200, true, map[string]string{allowOrigin: "https://app.example", allowMethods: ""}, []string{"Origin"}},
+	}
+	for _, tt := range tests {
+		reached := false
+		handler := cors(tt.cfg, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { reached = true }))
+		r := httptest.NewRequest(tt.method, "/todos", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+
+		if rw.Code != tt.status || reached != tt.reached {
+			t.Errorf("%s: got %d, reached the api %v, want %d, %v", tt.name, rw.Code, reached, tt.status, tt.reached)
+		}
+		for k, want := range tt.want {
+			if got := rw.Header().Get(k); got != want {
+				t.Errorf("%s: %s is %q, want %q", tt.name, k, got, want)
+			}
+		}
+		if vary := rw.Header().Values("Vary"); !slices.Equal(vary, tt.vary) {
+			t.Errorf("%s: Vary %q, want %q", tt.name, vary, tt.vary)
+		}
+	}
+}
+
+// no route takes OPTIONS, preflights must be answered before the router gets to say 405
+func TestCORSPreflightNeedsNoRoute(t *testing.T) {
+	cfg := testConfig()
+	cfg.apiKey = "secret" // and browsers send no api key with a preflight
+	cfg.cors = corsConfig{origins: []string{"https://app.example"}, methods: []string{"DELETE"}}
+	srv := startTestAPI(t, cfg, nil)
+
+	req, _ := http.NewRequest("OPTIONS", srv.URL+"/todos/1", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Access-Control-Allow-Methods") != "DELETE" {
+		t.Errorf("preflight through the api: %d, allowed methods %q", res.StatusCode, res.Header.Get("Access-Control-Allow-Methods"))
+	}
+}
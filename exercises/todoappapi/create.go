@@ -0,0 +1,118 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// todoInput is what POST /todos accepts. The keys match the ones todo.MarshalJSON writes out,
+// or the v2 ones, see versions.go.
+type todoInput struct {
+	Description string
+	Done        bool
+	Duedate     string // RFC3339 or a plain 2006-01-02 date
+	Priority    string
+	Tags        []string
+	Project     string
+	Recurrence  string // an RRULE subset, or just daily, weekly, monthly, yearly
+	Parent      int    // makes the new todo a subtask of this one
+	BlockedBy   []int
+
+	// the v2 names for the keys above that aren't just lowercased
+	DueDate     string `json:"due_date"`
+	ParentID    int    `json:"parent_id"`
+	BlockedByV2 []int  `json:"blocked_by"`
+}
+
+// todoInputRules is what a todo has to look like, whichever api it comes in through
+var todoInputRules = []rule[todoInput]{
+	field("description", func(in todoInput) string { return in.Description }, required, maxLength(1000)),
+	field("due_date", func(in todoInput) string { return in.Duedate }, parses(parseDuedate)),
+	field("priority", func(in todoInput) string { return in.Priority }, parses(parsePriority)),
+	field("tags", func(in todoInput) []string { return in.Tags }, maxItems[string](20)),
+	each("tags", func(in todoInput) []string { return in.Tags }, maxLength(50)),
+	field("project", func(in todoInput) string { return in.Project }, maxLength(100)),
+	field("recurrence", func(in todoInput) string { return in.Recurrence }, parses(parseRecurrence)),
+	field("parent_id", func(in todoInput) int { return in.Parent }, atLeast(0)),
+	field("blocked_by", func(in todoInput) []int { return in.BlockedBy }, maxItems[int](100)),
+	each("blocked_by", func(in todoInput) []int { return in.BlockedBy }, atLeast(1)),
+}
+
+// toTodo validates in against todoInputRules, the error is a validationError
+func (in todoInput) toTodo() (todo, error) {
+	in.Duedate = cmp.Or(in.Duedate, in.DueDate)
+	in.Parent = cmp.Or(in.Parent, in.ParentID)
+	if in.BlockedBy == nil {
+		in.BlockedBy = in.BlockedByV2
+	}
+	if err := validate(in, todoInputRules); err != nil {
+		return todo{}, err
+	}
+
+	// the parse errors are all caught by the rules above
+	t := todo{
+		description: strings.TrimSpace(in.Description),
+		done:        in.Done,
+		project:     strings.TrimSpace(in.Project),
+		parent:      in.Parent,
+	}
+	t.priority, _ = parsePriority(in.Priority)
+	t.duedate, _ = parseDuedate(in.Duedate)
+	t.recurrence, _ = parseRecurrence(in.Recurrence)
+
+	seen := map[string]bool{}
+	for _, tag := range in.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		t.tags = append(t.tags, tag)
+	}
+	sort.Strings(t.tags) // the stores hand tags back sorted by name
+
+	blockers := map[int]bool{}
+	for _, id := range in.BlockedBy {
+		if !blockers[id] {
+			blockers[id] = true
+			t.blockedBy = append(t.blockedBy, id)
+		}
+	}
+	return t, nil
+}
+
+func parseDuedate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.Parse(time.RFC3339, s); err == nil {
+		return d, nil
+	}
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("duedate %q is neither RFC3339 nor YYYY-MM-DD", s)
+	}
+	return d, nil
+}
+
+func create(rw http.ResponseWriter, r *http.Request) {
+	var in todoInput
+	decodeErr := decodeBody(rw, r.Body, &in)
+	t, err := in.toTodo()
+	if err = joinValidation(decodeErr, err); err != nil {
+		writeBodyError(rw, err)
+		return
+	}
+
+	if t, err = store.Create(r.Context(), t); err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Location", todoPath(r.Context(), t.id))
+	writeJSON(rw, http.StatusCreated, t)
+}
@@ -1,21 +1,21 @@
 package main
 
 import (
-	"log"
+	"errors"
 	"net/http"
-
-	"github.com/gorilla/mux"
 )
 
-func delete(rw http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	query := `DELETE FROM todos WHERE id = $1`
+func destroy(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
 
-	rows, err := db.Query(query, id)
-	if err != nil {
-		log.Fatal(err)
+	// deleting a todo that is already gone is fine
+	if err := store.Delete(r.Context(), id); err != nil && !errors.Is(err, errNotFound) {
+		writeStoreError(rw, err)
+		return
 	}
-	defer rows.Close()
 
 	rw.WriteHeader(http.StatusOK)
 }
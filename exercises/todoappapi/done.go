@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+)
+
+// POST /todos/{id}/done marks a todo done. If the todo recurs, the response also carries
+// the freshly created next occurrence, otherwise Next is null.
+// A todo with open subtasks or open blockers cannot be marked done and gets a 409.
+func done(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
+
+	completed, next, err := store.Complete(r.Context(), id)
+	if err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, doneResponse{completed, next})
+}
+
+type doneResponse struct {
+	Todo todo
+	Next *todo
+}
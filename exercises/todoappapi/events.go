@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+type todoEventType string
+
+const (
+	todoCreated todoEventType = "created"
+	todoUpdated todoEventType = "updated"
+	todoDeleted todoEventType = "deleted"
+)
+
+// todoEvent is one change to one todo. todo is the state after the change and zero for deletes.
+type todoEvent struct {
+	typ       todoEventType
+	id        int
+	todo      todo
+	workspace string
+}
+
+// changeFeed fans events out to every subscriber of the workspace they happened in. Publishing
+// never blocks: a subscriber whose buffer is full gets its channel closed instead, and has to
+// catch up by listing again.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[chan todoEvent]string // the workspace every subscriber watches
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subs: map[chan todoEvent]string{}}
+}
+
+// subscribe returns a channel of the events in workspace and a func to stop receiving them.
+// The channel is closed after cancel, or when the subscriber falls too far behind.
+func (f *changeFeed) subscribe(workspace string) (<-chan todoEvent, func()) {
+	ch := make(chan todoEvent, 64)
+
+	f.mu.Lock()
+	f.subs[ch] = workspace
+	f.mu.Unlock()
+
+	return ch, func() { f.drop(ch) }
+}
+
+func (f *changeFeed) publish(ev todoEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch, workspace := range f.subs {
+		if workspace != ev.workspace {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (f *changeFeed) drop(ch chan todoEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// eventStore wraps a todoStore and publishes a todoEvent for every successful write,
+// no matter whether it came in over REST or grpc. Events are in the workspace of the write.
+// Subtasks removed by a cascading delete don't get events of their own.
+type eventStore struct {
+	todoStore
+	feed *changeFeed
+}
+
+func newEventStore(s todoStore, feed *changeFeed) *eventStore {
+	return &eventStore{todoStore: s, feed: feed}
+}
+
+func (s *eventStore) Create(ctx context.Context, t todo) (todo, error) {
+	t, err := s.todoStore.Create(ctx, t)
+	if err == nil {
+		s.feed.publish(todoEvent{typ: todoCreated, id: t.id, todo: t, workspace: workspaceOf(ctx)})
+	}
+	return t, err
+}
+
+func (s *eventStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	todos, err := s.todoStore.Import(ctx, todos)
+	if err == nil {
+		for _, t := range todos {
+			s.feed.publish(todoEvent{typ: todoCreated, id: t.id, todo: t, workspace: workspaceOf(ctx)})
+		}
+	}
+	return todos, err
+}
+
+func (s *eventStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	t, next, err := s.todoStore.Update(ctx, t)
+	if err != nil {
+		return t, next, err
+	}
+	s.feed.publish(todoEvent{typ: todoUpdated, id: t.id, todo: t, workspace: workspaceOf(ctx)})
+	if next != nil {
+		s.feed.publish(todoEvent{typ: todoCreated, id: next.id, todo: *next, workspace: workspaceOf(ctx)})
+	}
+	return t, next, nil
+}
+
+func (s *eventStore) Delete(ctx context.Context, id int) error {
+	err := s.todoStore.Delete(ctx, id)
+	if err == nil {
+		s.feed.publish(todoEvent{typ: todoDeleted, id: id, workspace: workspaceOf(ctx)})
+	}
+	return err
+}
+
+func (s *eventStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	t, next, err := s.todoStore.Complete(ctx, id)
+	if err != nil {
+		return t, next, err
+	}
+	s.feed.publish(todoEvent{typ: todoUpdated, id: t.id, todo: t, workspace: workspaceOf(ctx)})
+	if next != nil {
+		s.feed.publish(todoEvent{typ: todoCreated, id: next.id, todo: *next, workspace: workspaceOf(ctx)})
+	}
+	return t, next, nil
+}
+
+func (s *eventStore) SetParent(ctx context.Context, id, parent int) error {
+	return s.updated(ctx, id, s.todoStore.SetParent(ctx, id, parent))
+}
+
+func (s *eventStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	return s.updated(ctx, id, s.todoStore.AddBlocker(ctx, id, blocker))
+}
+
+func (s *eventStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	return s.updated(ctx, id, s.todoStore.RemoveBlocker(ctx, id, blocker))
+}
+
+// updated publishes the todo as it is after a successful relation change
+func (s *eventStore) updated(ctx context.Context, id int, err error) error {
+	if err != nil {
+		return err
+	}
+	if t, getErr := s.todoStore.Get(ctx, id); getErr == nil {
+		s.feed.publish(todoEvent{typ: todoUpdated, id: id, todo: t, workspace: workspaceOf(ctx)})
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+// newGraphQLHandler serves POST /graphql. Like the grpc server it gets the store handed in,
+// and input goes through todoInput so every api validates the same way.
+func newGraphQLHandler(store todoStore) http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{store: store})
+	return &relay.Handler{Schema: schema}
+}
+
+type graphqlResolver struct {
+	store todoStore
+}
+
+type todosArgs struct {
+	Filter *struct {
+		Priority *string
+		Project  *string
+		Tags     *[]string
+	}
+	First int32
+	After *graphql.ID
+}
+
+func (r *graphqlResolver) Todos(ctx context.Context, args todosArgs) (*todoConnectionResolver, error) {
+	if args.First < 1 || args.First > 100 {
+		return nil, graphqlError{"invalid_argument", "first has to be between 1 and 100"}
+	}
+	after := 0
+	if args.After != nil {
+		var err error
+		if after, err = graphqlID(*args.After); err != nil {
+			return nil, err
+		}
+	}
+
+	var filter todoFilter
+	if f := args.Filter; f != nil {
+		if f.Priority != nil {
+			p, _ := parsePriority(strings.ToLower(*f.Priority)) // the schema enum only lets valid names through
+			filter.priority = &p
+		}
+		if f.Project != nil {
+			filter.project = *f.Project
+		}
+		if f.Tags != nil {
+			filter.tags = *f.Tags
+		}
+	}
+
+	todos, err := r.store.List(ctx, filter)
+	if err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+
+	// List comes back ordered by id, so the cursor is simply the last id seen
+	conn := &todoConnectionResolver{totalCount: int32(len(todos))}
+	for _, t := range todos {
+		if t.id <= after {
+			continue
+		}
+		if len(conn.nodes) == int(args.First) {
+			conn.hasNextPage = true
+			break
+		}
+		conn.nodes = append(conn.nodes, &todoResolver{t: t, store: r.store})
+	}
+	return conn, nil
+}
+
+func (r *graphqlResolver) Todo(ctx context.Context, args struct{ ID graphql.ID }) (*todoResolver, error) {
+	id, err := graphqlID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.store.Get(ctx, id)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+	return &todoResolver{t: t, store: r.store}, nil
+}
+
+type createTodoArgs struct {
+	Input struct {
+		Description string
+		Done        *bool
+		Duedate     *string
+		Priority    *string
+		Tags        *[]string
+		Project     *string
+		Recurrence  *string
+		Parent      *graphql.ID
+		BlockedBy   *[]graphql.ID
+	}
+}
+
+func (r *graphqlResolver) CreateTodo(ctx context.Context, args createTodoArgs) (*todoResolver, error) {
+	input := args.Input
+	in := todoInput{
+		Description: input.Description,
+		Done:        deref(input.Done),
+		Duedate:     deref(input.Duedate),
+		Priority:    strings.ToLower(deref(input.Priority)),
+		Tags:        deref(input.Tags),
+		Project:     deref(input.Project),
+		Recurrence:  deref(input.Recurrence),
+	}
+	if input.Parent != nil {
+		parent, err := graphqlID(*input.Parent)
+		if err != nil {
+			return nil, err
+		}
+		in.Parent = parent
+	}
+	for _, blocker := range deref(input.BlockedBy) {
+		id, err := graphqlID(blocker)
+		if err != nil {
+			return nil, err
+		}
+		in.BlockedBy = append(in.BlockedBy, id)
+	}
+
+	t, err := in.toTodo()
+	if err != nil {
+		return nil, graphqlInputError(err)
+	}
+	if t, err = r.store.Create(ctx, t); err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+	return &todoResolver{t: t, store: r.store}, nil
+}
+
+type updateTodoArgs struct {
+	ID    graphql.ID
+	Input struct {
+		Description *string
+		Done        *bool
+		Duedate     *string
+		Priority    *string
+		Tags        *[]string
+		Project     *string
+		Recurrence  *string
+	}
+}
+
+func (r *graphqlResolver) UpdateTodo(ctx context.Context, args updateTodoArgs) (*todoResolver, error) {
+	id, err := graphqlID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.store.Get(ctx, id)
+	if err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+
+	// start from the todo as it is, lay the patch over it and validate the result like a new todo
+	in := todoInput{
+		Description: current.description,
+		Done:        current.done,
+		Priority:    current.priority.String(),
+		Tags:        current.tags,
+		Project:     current.project,
+		Recurrence:  current.recurrence.String(),
+	}
+	if !current.duedate.IsZero() {
+		in.Duedate = current.duedate.Format(time.RFC3339)
+	}
+	patch := args.Input
+	if patch.Description != nil {
+		in.Description = *patch.Description
+	}
+	if patch.Duedate != nil {
+		in.Duedate = *patch.Duedate
+	}
+	if patch.Priority != nil {
+		in.Priority = strings.ToLower(*patch.Priority)
+	}
+	if patch.Tags != nil {
+		in.Tags = *patch.Tags
+	}
+	if patch.Project != nil {
+		in.Project = *patch.Project
+	}
+	if patch.Recurrence != nil {
+		in.Recurrence = *patch.Recurrence
+	}
+	if patch.Done != nil {
+		in.Done = *patch.Done
+	}
+
+	t, err := in.toTodo()
+	if err != nil {
+		return nil, graphqlInputError(err)
+	}
+	t.id = id
+
+	// marking done is checked by the store, in the same write as the rest of the patch
+	if t, _, err = r.store.Update(ctx, t); err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+	return &todoResolver{t: t, store: r.store}, nil
+}
+
+func (r *graphqlResolver) DeleteTodo(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	id, err := graphqlID(args.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := r.store.Delete(ctx, id); err != nil && !errors.Is(err, errNotFound) {
+		return "", graphqlStoreError(ctx, err)
+	}
+	return args.ID, nil
+}
+
+type todoConnectionResolver struct {
+	nodes       []*todoResolver
+	totalCount  int32
+	hasNextPage bool
+}
+
+func (c *todoConnectionResolver) Nodes() []*todoResolver { return c.nodes }
+func (c *todoConnectionResolver) TotalCount() int32      { return c.totalCount }
+func (c *todoConnectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNextPage: c.hasNextPage}
+	if len(c.nodes) > 0 {
+		p.endCursor = c.nodes[len(c.nodes)-1].ID()
+	}
+	return p
+}
+
+type pageInfoResolver struct {
+	endCursor   graphql.ID
+	hasNextPage bool
+}
+
+func (p *pageInfoResolver) EndCursor() *graphql.ID {
+	if p.endCursor == "" {
+		return nil
+	}
+	return &p.endCursor
+}
+func (p *pageInfoResolver) HasNextPage() bool { return p.hasNextPage }
+
+// todoResolver is one todo. Related todos are only loaded when a query asks for them.
+type todoResolver struct {
+	t     todo
+	store todoStore
+	tree  bool // t came out of Tree, so t.subtasks is complete and needs no extra query
+}
+
+func (r *todoResolver) ID() graphql.ID      { return graphql.ID(strconv.Itoa(r.t.id)) }
+func (r *todoResolver) Description() string { return r.t.description }
+func (r *todoResolver) Done() bool          { return r.t.done }
+func (r *todoResolver) Priority() string    { return strings.ToUpper(r.t.priority.String()) }
+func (r *todoResolver) Tags() []string      { return append([]string{}, r.t.tags...) }
+func (r *todoResolver) Project() *string    { return optional(r.t.project) }
+func (r *todoResolver) Recurrence() *string { return optional(r.t.recurrence.String()) }
+
+func (r *todoResolver) Duedate() *string {
+	if r.t.duedate.IsZero() {
+		return nil
+	}
+	return optional(r.t.duedate.Format("2006-01-02"))
+}
+
+func (r *todoResolver) Parent(ctx context.Context) (*todoResolver, error) {
+	if r.t.parent == 0 {
+		return nil, nil
+	}
+	t, err := r.store.Get(ctx, r.t.parent)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlStoreError(ctx, err)
+	}
+	return &todoResolver{t: t, store: r.store}, nil
+}
+
+func (r *todoResolver) Subtasks(ctx context.Context) ([]*todoResolver, error) {
+	t := r.t
+	if !r.tree {
+		var err error
+		if t, err = r.store.Tree(ctx, r.t.id); err != nil {
+			return nil, graphqlStoreError(ctx, err)
+		}
+	}
+	subtasks := []*todoResolver{}
+	for _, sub := range t.subtasks {
+		subtasks = append(subtasks, &todoResolver{t: sub, store: r.store, tree: true})
+	}
+	return subtasks, nil
+}
+
+func (r *todoResolver) BlockedBy(ctx context.Context) ([]*todoResolver, error) {
+	blockers := []*todoResolver{}
+	for _, id := range r.t.blockedBy {
+		t, err := r.store.Get(ctx, id)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, graphqlStoreError(ctx, err)
+		}
+		blockers = append(blockers, &todoResolver{t: t, store: r.store})
+	}
+	return blockers, nil
+}
+
+// graphqlError ends up in the response's errors list, with the same codes the REST api uses
+// under extensions.code
+type graphqlError struct {
+	code    string
+	message string
+}
+
+func (e graphqlError) Error() string { return e.message }
+
+func (e graphqlError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// graphqlValidationError lists the bad fields of an input in its extensions
+type graphqlValidationError struct {
+	validationError
+}
+
+func (e graphqlValidationError) Extensions() map[string]any {
+	return map[string]any{"code": "validation_failed", "fields": fieldErrorsV2(e.validationError)}
+}
+
+// graphqlInputError is writeBodyError for graphql
+func graphqlInputError(err error) error {
+	var invalid validationError
+	if errors.As(err, &invalid) {
+		return graphqlValidationError{invalid}
+	}
+	return graphqlError{"invalid_todo", err.Error()}
+}
+
+// graphqlStoreError is writeStoreError for graphql
+func graphqlStoreError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, errNotFound):
+		return graphqlError{"not_found", err.Error()}
+	case errors.Is(err, errUnknownReference):
+		return graphqlError{"unknown_reference", err.Error()}
+	case errors.Is(err, errCycle):
+		return graphqlError{"cycle", err.Error()}
+	case errors.Is(err, errOpenSubtasks):
+		return graphqlError{"open_subtasks", err.Error()}
+	case errors.Is(err, errBlocked):
+		return graphqlError{"blocked", err.Error()}
+	case errors.Is(err, errHasSubtasks):
+		return graphqlError{"has_subtasks", err.Error()}
+	}
+	slog.ErrorContext(ctx, "internal error", "err", err)
+	return graphqlError{"internal", "something went wrong on our end"}
+}
+
+func graphqlID(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil || n <= 0 {
+		return 0, graphqlError{"invalid_id", fmt.Sprintf("%q is not a valid todo id", id)}
+	}
+	return n, nil
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
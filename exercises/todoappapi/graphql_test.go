@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// postGraphQL runs query against the api at url and returns the error codes it answered with
+func postGraphQL(t *testing.T, url, query string) []string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	res, err := http.Post(url+"/graphql", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Errors []struct {
+			Message    string
+			Extensions struct{ Code string }
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, e := range out.Errors {
+		codes = append(codes, e.Extensions.Code)
+	}
+	return codes
+}
+
+func TestGraphQLUpdateKeepsTheTimeOfDay(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	ctx := context.Background()
+	due := time.Date(2026, 5, 1, 15, 30, 0, 0, time.UTC)
+	td := mustCreate(t, ctx, store, todo{description: "call the bank", duedate: due})
+
+	if codes := postGraphQL(t, srv.URL, `mutation { updateTodo(id: "`+strconv.Itoa(td.id)+`", input: {description: "call the bank back"}) { id } }`); codes != nil {
+		t.Fatalf("updateTodo: %v", codes)
+	}
+	got, err := store.Get(ctx, td.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.duedate.Equal(due) {
+		t.Errorf("duedate went from %v to %v", due, got.duedate)
+	}
+}
+
+func TestGraphQLUpdateThatCantCompleteChangesNothing(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	ctx := context.Background()
+	blocker := mustCreate(t, ctx, store, todo{description: "blocker"})
+	blocked := mustCreate(t, ctx, store, todo{description: "blocked", blockedBy: []int{blocker.id}})
+
+	codes := postGraphQL(t, srv.URL, `mutation { updateTodo(id: "`+strconv.Itoa(blocked.id)+`", input: {description: "renamed", done: true}) { id } }`)
+	if len(codes) != 1 || codes[0] != "blocked" {
+		t.Fatalf("got errors %v, want blocked", codes)
+	}
+	got, err := store.Get(ctx, blocked.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.description != "blocked" || got.done {
+		t.Errorf("a refused update still changed the todo to %q, done %v", got.description, got.done)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/todopb"
+)
+
+// grpcServer is the grpc face of the same store the REST handlers use.
+// Input goes through todoInput just like POST /todos, so both apis validate the same way.
+type grpcServer struct {
+	todopb.UnimplementedTodoServiceServer
+	store todoStore
+	feed  *changeFeed
+}
+
+func newGRPCServer(cfg config, tlsCfg *tls.Config, tracer *tracer, store todoStore, feed *changeFeed) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (res any, err error) {
+			ctx, sp := grpcTrace(ctx, tracer, info.FullMethod)
+			grpc.SetHeader(ctx, metadata.Pairs("traceparent", sp.traceparent()))
+			defer func() { grpcFinish(sp, err) }()
+
+			if ctx, err = grpcWorkspace(ctx, cfg); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) (err error) {
+			ctx, sp := grpcTrace(ss.Context(), tracer, info.FullMethod)
+			ss.SetHeader(metadata.Pairs("traceparent", sp.traceparent()))
+			defer func() { grpcFinish(sp, err) }()
+
+			if ctx, err = grpcWorkspace(ctx, cfg); err != nil {
+				return err
+			}
+			return next(srv, workspaceStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+
+	server := grpc.NewServer(opts...)
+	todopb.RegisterTodoServiceServer(server, &grpcServer{store: store, feed: feed})
+	return server
+}
+
+// grpcTrace is traceRequests for grpc, the caller's traceparent comes in the metadata
+func grpcTrace(ctx context.Context, t *tracer, method string) (context.Context, *span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("traceparent"); len(v) > 0 {
+		if remote, ok := parseTraceparent(v[0]); ok {
+			ctx = context.WithValue(ctx, spanContextKey{}, remote)
+		}
+	}
+	return t.start(ctx, method, "rpc.method", method)
+}
+
+// grpcFinish marks the span failed for what REST would have answered with a 5xx
+func grpcFinish(sp *span, err error) {
+	code := status.Code(err)
+	sp.setAttr("rpc.grpc.status_code", code.String())
+	switch code {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		sp.finish(err)
+	default:
+		sp.finish(nil)
+	}
+}
+
+// checkGRPCAPIKey is requireAPIKey for grpc, the key travels in the authorization metadata
+func checkGRPCAPIKey(ctx context.Context, key string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if got, ok := strings.CutPrefix(v, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "a valid api key is required")
+}
+
+// grpcWorkspace is requireAPIKey and scopeToWorkspace for grpc, the workspace header travels
+// in the x-workspace metadata
+func grpcWorkspace(ctx context.Context, cfg config) (context.Context, error) {
+	if cfg.apiKey != "" && len(cfg.workspaceKeys) == 0 {
+		if err := checkGRPCAPIKey(ctx, cfg.apiKey); err != nil {
+			return nil, err
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	workspace, err := resolveWorkspace(cfg, first("authorization"), first("x-workspace"))
+	switch {
+	case errors.Is(err, errUnauthorized):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, errWrongWorkspace), errors.Is(err, errWorkspaceHeader):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return withWorkspace(ctx, workspace), nil
+}
+
+// workspaceStream is a server stream whose Context carries the workspace
+type workspaceStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s workspaceStream) Context() context.Context { return s.ctx }
+
+func serveGRPC(addr string, server *grpc.Server) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := server.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *grpcServer) ListTodos(ctx context.Context, req *todopb.ListTodosRequest) (*todopb.ListTodosResponse, error) {
+	filter := todoFilter{project: req.GetProject(), tags: req.GetTags()}
+	if req.Priority != nil {
+		p := priority(req.GetPriority())
+		filter.priority = &p
+	}
+
+	todos, err := s.store.List(ctx, filter)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	res := &todopb.ListTodosResponse{}
+	for _, t := range todos {
+		res.Todos = append(res.Todos, todoToProto(t))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetTodo(ctx context.Context, req *todopb.GetTodoRequest) (*todopb.GetTodoResponse, error) {
+	var (
+		t   todo
+		err error
+	)
+	if req.GetNested() {
+		t, err = s.store.Tree(ctx, int(req.GetId()))
+	} else {
+		t, err = s.store.Get(ctx, int(req.GetId()))
+	}
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &todopb.GetTodoResponse{Todo: todoToProto(t)}, nil
+}
+
+func (s *grpcServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.CreateTodoResponse, error) {
+	if _, ok := todopb.Priority_name[int32(req.GetPriority())]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown priority %d", req.GetPriority())
+	}
+	in := todoInput{
+		Description: req.GetDescription(),
+		Done:        req.GetDone(),
+		Duedate:     req.GetDuedate(),
+		Priority:    priority(req.GetPriority()).String(),
+		Tags:        req.GetTags(),
+		Project:     req.GetProject(),
+		Recurrence:  req.GetRecurrence(),
+		Parent:      int(req.GetParent()),
+	}
+	for _, id := range req.GetBlockedBy() {
+		in.BlockedBy = append(in.BlockedBy, int(id))
+	}
+
+	t, err := in.toTodo()
+	if err != nil {
+		return nil, grpcInputError(err)
+	}
+	if t, err = s.store.Create(ctx, t); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &todopb.CreateTodoResponse{Todo: todoToProto(t)}, nil
+}
+
+func (s *grpcServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*todopb.DeleteTodoResponse, error) {
+	// a todo that is already gone is deleted as far as the caller is concerned, but it isn't
+	// news for the watchers, the event store only publishes what it really deleted
+	if err := s.store.Delete(ctx, int(req.GetId())); err != nil && !errors.Is(err, errNotFound) {
+		return nil, grpcError(ctx, err)
+	}
+	return &todopb.DeleteTodoResponse{}, nil
+}
+
+func (s *grpcServer) CompleteTodo(ctx context.Context, req *todopb.CompleteTodoRequest) (*todopb.CompleteTodoResponse, error) {
+	t, next, err := s.store.Complete(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	res := &todopb.CompleteTodoResponse{Todo: todoToProto(t)}
+	if next != nil {
+		res.Next = todoToProto(*next)
+	}
+	return res, nil
+}
+
+func (s *grpcServer) SetParent(ctx context.Context, req *todopb.SetParentRequest) (*todopb.SetParentResponse, error) {
+	t, err := s.relation(ctx, req.GetId(), s.store.SetParent(ctx, int(req.GetId()), int(req.GetParent())))
+	if err != nil {
+		return nil, err
+	}
+	return &todopb.SetParentResponse{Todo: t}, nil
+}
+
+func (s *grpcServer) AddBlocker(ctx context.Context, req *todopb.AddBlockerRequest) (*todopb.AddBlockerResponse, error) {
+	t, err := s.relation(ctx, req.GetId(), s.store.AddBlocker(ctx, int(req.GetId()), int(req.GetBlocker())))
+	if err != nil {
+		return nil, err
+	}
+	return &todopb.AddBlockerResponse{Todo: t}, nil
+}
+
+func (s *grpcServer) RemoveBlocker(ctx context.Context, req *todopb.RemoveBlockerRequest) (*todopb.RemoveBlockerResponse, error) {
+	t, err := s.relation(ctx, req.GetId(), s.store.RemoveBlocker(ctx, int(req.GetId()), int(req.GetBlocker())))
+	if err != nil {
+		return nil, err
+	}
+	return &todopb.RemoveBlockerResponse{Todo: t}, nil
+}
+
+// relation is updateRelation for grpc: the todo as it looks after the change
+func (s *grpcServer) relation(ctx context.Context, id int64, err error) (*todopb.Todo, error) {
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	t, err := s.store.Get(ctx, int(id))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return todoToProto(t), nil
+}
+
+func (s *grpcServer) SearchTodos(ctx context.Context, req *todopb.SearchTodosRequest) (*todopb.SearchTodosResponse, error) {
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = 20
+	}
+	if limit < 1 || limit > 100 {
+		return nil, status.Error(codes.InvalidArgument, "limit has to be between 1 and 100")
+	}
+
+	results, err := s.store.Search(ctx, query, limit)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	res := &todopb.SearchTodosResponse{}
+	for _, r := range results {
+		res.Results = append(res.Results, &todopb.SearchResult{Todo: todoToProto(r.Todo), Rank: r.Rank, Snippet: r.Snippet})
+	}
+	return res, nil
+}
+
+func (s *grpcServer) WatchTodos(_ *todopb.WatchTodosRequest, stream grpc.ServerStreamingServer[todopb.WatchTodosResponse]) error {
+	events, cancel := s.feed.subscribe(workspaceOf(stream.Context()))
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "fell too far behind on changes, list again and re-watch")
+			}
+			if err := stream.Send(&todopb.WatchTodosResponse{Event: eventToProto(ev)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcInputError is writeBodyError for grpc, bad fields go out as BadRequest details
+func grpcInputError(err error) error {
+	st := status.New(codes.InvalidArgument, err.Error())
+	var invalid validationError
+	if !errors.As(err, &invalid) {
+		return st.Err()
+	}
+	details := &errdetails.BadRequest{}
+	for _, f := range invalid {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field: f.Field, Description: f.Message, Reason: f.Reason,
+		})
+	}
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// grpcError is writeStoreError for grpc
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, errNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errUnknownReference):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errCycle), errors.Is(err, errOpenSubtasks), errors.Is(err, errBlocked), errors.Is(err, errHasSubtasks):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	slog.ErrorContext(ctx, "internal error", "err", err)
+	return status.Error(codes.Internal, "something went wrong on our end")
+}
+
+func todoToProto(t todo) *todopb.Todo {
+	pb := &todopb.Todo{
+		Id:          int64(t.id),
+		Description: t.description,
+		Done:        t.done,
+		Priority:    todopb.Priority(t.priority),
+		Tags:        t.tags,
+		Project:     t.project,
+		Recurrence:  t.recurrence.String(),
+		Parent:      int64(t.parent),
+	}
+	if !t.duedate.IsZero() {
+		pb.Duedate = t.duedate.Format("2006-01-02")
+	}
+	for _, id := range t.blockedBy {
+		pb.BlockedBy = append(pb.BlockedBy, int64(id))
+	}
+	for _, sub := range t.subtasks {
+		pb.Subtasks = append(pb.Subtasks, todoToProto(sub))
+	}
+	return pb
+}
+
+func eventToProto(ev todoEvent) *todopb.TodoEvent {
+	pb := &todopb.TodoEvent{Id: int64(ev.id)}
+	switch ev.typ {
+	case todoCreated:
+		pb.Type = todopb.TodoEvent_TYPE_CREATED
+	case todoUpdated:
+		pb.Type = todopb.TodoEvent_TYPE_UPDATED
+	case todoDeleted:
+		pb.Type = todopb.TodoEvent_TYPE_DELETED
+	}
+	if ev.typ != todoDeleted {
+		pb.Todo = todoToProto(ev.todo)
+	}
+	return pb
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/todopb"
+)
+
+// startTestGRPC serves the grpc api on a memory store over an in-memory listener
+func startTestGRPC(t *testing.T, cfg config) todopb.TodoServiceClient {
+	t.Helper()
+	feed := newChangeFeed()
+	return dialTestGRPC(t, newGRPCServer(cfg, nil, newTracer(discardExporter{}), newEventStore(newMemoryStore(), feed), feed))
+}
+
+func dialTestGRPC(t *testing.T, server *grpc.Server) todopb.TodoServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return todopb.NewTodoServiceClient(conn)
+}
+
+func expectCode(t *testing.T, what string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got %v (%v), want %v", what, got, err, want)
+	}
+}
+
+func TestGRPCTodos(t *testing.T) {
+	c := startTestGRPC(t, testConfig())
+	ctx := context.Background()
+
+	created, err := c.CreateTodo(ctx, &todopb.CreateTodoRequest{
+		Description: "water the plants", Duedate: "2026-05-01", Priority: todopb.Priority_PRIORITY_HIGH,
+		Tags: []string{"home"}, Recurrence: "weekly",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plants := created.GetTodo()
+	if plants.GetId() == 0 || plants.GetDuedate() != "2026-05-01" || plants.GetRecurrence() != "FREQ=WEEKLY" {
+		t.Errorf("created %v", plants)
+	}
+	sub, err := c.CreateTodo(ctx, &todopb.CreateTodoRequest{Description: "buy plant food"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SetParent(ctx, &todopb.SetParentRequest{Id: sub.GetTodo().GetId(), Parent: plants.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetTodo(ctx, &todopb.GetTodoRequest{Id: plants.GetId(), Nested: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GetTodo().GetSubtasks()) != 1 {
+		t.Errorf("nested get has subtasks %v", got.GetTodo().GetSubtasks())
+	}
+
+	high := todopb.Priority_PRIORITY_HIGH
+	list, err := c.ListTodos(ctx, &todopb.ListTodosRequest{Priority: &high})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.GetTodos()) != 1 || list.GetTodos()[0].GetId() != plants.GetId() {
+		t.Errorf("listed %v", list.GetTodos())
+	}
+
+	if _, err := c.CompleteTodo(ctx, &todopb.CompleteTodoRequest{Id: sub.GetTodo().GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	done, err := c.CompleteTodo(ctx, &todopb.CompleteTodoRequest{Id: plants.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done.GetTodo().GetDone() || done.GetNext().GetDuedate() != "2026-05-08" {
+		t.Errorf("completed %v, next %v", done.GetTodo(), done.GetNext())
+	}
+
+	if _, err := c.SetParent(ctx, &todopb.SetParentRequest{Id: sub.GetTodo().GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: plants.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetTodo(ctx, &todopb.GetTodoRequest{Id: plants.GetId()})
+	expectCode(t, "GetTodo after DeleteTodo", err, codes.NotFound)
+	_, err = c.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: plants.GetId()})
+	expectCode(t, "DeleteTodo twice", err, codes.OK)
+}
+
+func TestGRPCErrorCodes(t *testing.T) {
+	c := startTestGRPC(t, testConfig())
+	ctx := context.Background()
+
+	parent, _ := c.CreateTodo(ctx, &todopb.CreateTodoRequest{Description: "parent"})
+	child, _ := c.CreateTodo(ctx, &todopb.CreateTodoRequest{Description: "child", Parent: parent.GetTodo().GetId()})
+	blocked, _ := c.CreateTodo(ctx, &todopb.CreateTodoRequest{Description: "blocked", BlockedBy: []int64{child.GetTodo().GetId()}})
+
+	_, err := c.GetTodo(ctx, &todopb.GetTodoRequest{Id: 999})
+	expectCode(t, "GetTodo of an unknown id", err, codes.NotFound)
+	_, err = c.CompleteTodo(ctx, &todopb.CompleteTodoRequest{Id: 999})
+	expectCode(t, "CompleteTodo of an unknown id", err, codes.NotFound)
+	_, err = c.SetParent(ctx, &todopb.SetParentRequest{Id: parent.GetTodo().GetId(), Parent: child.GetTodo().GetId()})
+	expectCode(t, "SetParent under its own subtask", err, codes.FailedPrecondition)
+	_, err = c.SetParent(ctx, &todopb.SetParentRequest{Id: parent.GetTodo().GetId(), Parent: 999})
+	expectCode(t, "SetParent onto an unknown todo", err, codes.InvalidArgument)
+	_, err = c.CompleteTodo(ctx, &todopb.CompleteTodoRequest{Id: blocked.GetTodo().GetId()})
+	expectCode(t, "CompleteTodo while blocked", err, codes.FailedPrecondition)
+	_, err = c.CompleteTodo(ctx, &todopb.CompleteTodoRequest{Id: parent.GetTodo().GetId()})
+	expectCode(t, "CompleteTodo with an open subtask", err, codes.FailedPrecondition)
+	_, err = c.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: parent.GetTodo().GetId()})
+	expectCode(t, "DeleteTodo with a subtask", err, codes.FailedPrecondition)
+	_, err = c.SearchTodos(ctx, &todopb.SearchTodosRequest{})
+	expectCode(t, "SearchTodos without a query", err, codes.InvalidArgument)
+
+	_, err = c.CreateTodo(ctx, &todopb.CreateTodoRequest{Duedate: "someday"})
+	expectCode(t, "CreateTodo of an invalid todo", err, codes.InvalidArgument)
+	var fields []string
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 {
+		t.Errorf("CreateTodo of an invalid todo: field violations for %v, want description and duedate", fields)
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	cfg := testConfig()
+	cfg.apiKey = "admin"
+	cfg.workspaceKeys = workspaceKeys{"ka": "alpha"}
+	c := startTestGRPC(t, cfg)
+
+	with := func(pairs ...string) context.Context {
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(pairs...))
+	}
+	_, err := c.ListTodos(context.Background(), &todopb.ListTodosRequest{})
+	expectCode(t, "without a key", err, codes.Unauthenticated)
+	_, err = c.ListTodos(with("authorization", "Bearer nope"), &todopb.ListTodosRequest{})
+	expectCode(t, "with a wrong key", err, codes.Unauthenticated)
+	_, err = c.ListTodos(with("authorization", "Bearer ka", "x-workspace", "beta"), &todopb.ListTodosRequest{})
+	expectCode(t, "with the key of another workspace", err, codes.PermissionDenied)
+	_, err = c.ListTodos(with("authorization", "Bearer admin", "x-workspace", "Not Valid"), &todopb.ListTodosRequest{})
+	expectCode(t, "with an invalid workspace", err, codes.InvalidArgument)
+	_, err = c.ListTodos(with("authorization", "Bearer ka"), &todopb.ListTodosRequest{})
+	expectCode(t, "with the workspace key", err, codes.OK)
+
+	open := startTestGRPC(t, testConfig())
+	_, err = open.ListTodos(with("x-workspace", "beta"), &todopb.ListTodosRequest{})
+	expectCode(t, "picking a workspace without any key", err, codes.PermissionDenied)
+}
+
+// Deleting what isn't there, here or in another workspace, must not reach the watchers
+func TestGRPCWatchOnlySeesRealDeletes(t *testing.T) {
+	cfg := testConfig()
+	cfg.openWorkspaces = true
+	c := startTestGRPC(t, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	elsewhere, err := c.CreateTodo(metadata.AppendToOutgoingContext(ctx, "x-workspace", "other"), &todopb.CreateTodoRequest{Description: "not yours"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := c.WatchTodos(ctx, &todopb.WatchTodosRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *todopb.TodoEvent, 100)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				close(events)
+				return
+			}
+			events <- res.GetEvent()
+		}
+	}()
+
+	// the watch is only in place once the first change comes through
+	var probe *todopb.Todo
+	for probe == nil {
+		created, err := c.CreateTodo(ctx, &todopb.CreateTodoRequest{Description: "probe"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-events:
+			probe = created.GetTodo()
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("the watch never saw a change")
+		}
+	}
+
+	for _, id := range []int64{999, elsewhere.GetTodo().GetId(), probe.GetId()} {
+		if _, err := c.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ev := range events {
+		if ev.GetType() == todopb.TodoEvent_TYPE_CREATED {
+			continue // more probes
+		}
+		if ev.GetType() != todopb.TodoEvent_TYPE_DELETED || ev.GetId() != probe.GetId() {
+			t.Errorf("got %v, want the delete of %d", ev, probe.GetId())
+		}
+		return
+	}
+	t.Fatal("the watch ended without the delete")
+}
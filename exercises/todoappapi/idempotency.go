@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyCache remembers the first answer to every mutating request that came with an
+// Idempotency-Key header, so a client retrying after a dropped connection gets that answer again
+// instead of a second todo. Keys are per client: the api key when there is one, the remote address
+// otherwise. Answers only live in this process for window, a restart forgets them.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[idempotencyKey]*idempotentResponse
+	lastSweep time.Time
+}
+
+type idempotencyKey struct {
+	client    [sha256.Size]byte
+	workspace string // one client can work in several workspaces
+	key       string
+}
+
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte // method, url and body of the first request
+	done        bool              // false while the first request is still being handled
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+const maxIdempotencyKeyLen = 255
+
+// maxIdempotentBodySize caps what gets read into memory to fingerprint a request. It's the
+// largest body any route takes, an archive, the routes' own limits (maxBodySize, maxImportSize)
+// still decide the rest.
+const maxIdempotentBodySize = maxArchiveSize
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{window: window, entries: map[idempotencyKey]*idempotentResponse{}}
+}
+
+func (c *idempotencyCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(rw, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key can be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			writeBodyError(rw, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		k := idempotencyKey{client: clientID(r), workspace: workspaceOf(r.Context()), key: key}
+		fingerprint := sha256.Sum256(append(fmt.Appendf(nil, "v%d %s %s\n", versionFromContext(r.Context()), r.Method, r.URL.RequestURI()), body...))
+
+		entry, first := c.begin(k, fingerprint)
+		switch {
+		case first:
+		case entry.fingerprint != fingerprint:
+			writeError(rw, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+			return
+		case !entry.done:
+			writeError(rw, http.StatusConflict, "idempotency_in_progress", "a request with this Idempotency-Key is still being handled")
+			return
+		default:
+			for name, values := range entry.header {
+				rw.Header()[name] = values
+			}
+			rw.Header().Set("Idempotent-Replayed", "true")
+			rw.WriteHeader(entry.status)
+			rw.Write(entry.body)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: rw, status: http.StatusOK}
+		defer func() { c.finish(k, rec) }()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// begin returns the entry stored under k, or stores a pending one and reports first
+func (c *idempotencyCache) begin(k idempotencyKey, fingerprint [sha256.Size]byte) (entry idempotentResponse, first bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for key, e := range c.entries {
+			if e.done && now.After(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if e, ok := c.entries[k]; ok && !(e.done && now.After(e.expires)) {
+		return *e, false
+	}
+	c.entries[k] = &idempotentResponse{fingerprint: fingerprint}
+	return idempotentResponse{}, true
+}
+
+// finish stores the answer for retries. Server errors are forgotten instead, so a retry gets
+// another go at it, and so is a handler that panicked before writing anything.
+func (c *idempotencyCache) finish(k idempotencyKey, rec *recordingWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !rec.wroteHeader || rec.status >= 500 {
+		delete(c.entries, k)
+		return
+	}
+	e := c.entries[k]
+	e.done = true
+	e.status = rec.status
+	e.header = rec.header
+	e.body = rec.body.Bytes()
+	e.expires = time.Now().Add(c.window)
+}
+
+// recordingWriter passes a response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// clientID tells clients apart by the api key they send, or by address when there is none.
+// Only a hash is kept so the cache never holds api keys.
+func clientID(r *http.Request) [sha256.Size]byte {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return sha256.Sum256([]byte("auth:" + auth))
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return sha256.Sum256([]byte("addr:" + host))
+}
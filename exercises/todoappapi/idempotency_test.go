@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestIdempotencyLimitsTheBody(t *testing.T) {
+	var handled int
+	handler := newIdempotencyCache(time.Hour).middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		handled++
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	send := func(body io.Reader) int {
+		r := httptest.NewRequest("PUT", "/todos/archive", body)
+		r.Header.Set("Idempotency-Key", "k")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+		return rw.Code
+	}
+	if got := send(io.LimitReader(zeros{}, maxIdempotentBodySize+1)); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("a body over the limit got %d, want 413", got)
+	}
+	if handled != 0 {
+		t.Error("a body over the limit reached the handler")
+	}
+	if got := send(strings.NewReader("{}")); got != http.StatusOK || handled != 1 {
+		t.Errorf("a small body got %d and was handled %d times", got, handled)
+	}
+}
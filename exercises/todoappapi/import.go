@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importLine is one todo read from an import file, with where it came from for error messages.
+// For json the line is the position in the array, starting at 1.
+type importLine struct {
+	line int
+	in   todoInput
+	err  error // what was wrong reading the line, a validationError goes along with toTodo's
+}
+
+type lineError struct {
+	Line    int
+	Message string
+	Fields  []fieldError `json:",omitempty"` // set when the line made it to validation
+}
+
+const maxImportSize = 10 << 20
+
+// POST /todos/import?format=csv|json|todotxt&dry_run=true
+//
+// Everything is parsed and validated before anything is written. A file with a single bad line
+// imports nothing and gets a 422 listing every bad line. Otherwise all todos go in in one
+// transaction, or, with dry_run, are only sent back the way they would be stored.
+// Ids from another tool mean nothing here, so parents and blockers are never imported.
+func importTodos(rw http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = importFormatFor(r.Header.Get("Content-Type"))
+	}
+	dryRun, err := strconv.ParseBool(cmp.Or(r.URL.Query().Get("dry_run"), "false"))
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid_query", "dry_run has to be true or false")
+		return
+	}
+
+	body := http.MaxBytesReader(rw, r.Body, maxImportSize)
+	var lines []importLine
+	switch format {
+	case "csv":
+		lines, err = parseCSVImport(body)
+	case "json":
+		lines, err = parseJSONImport(body)
+	case "todotxt":
+		lines, err = parseTodoTxtImport(body)
+	default:
+		writeError(rw, http.StatusBadRequest, "invalid_format", "format has to be csv, json or todotxt, or come from the Content-Type")
+		return
+	}
+	if err != nil {
+		writeBodyError(rw, err)
+		return
+	}
+
+	var (
+		todos    []todo
+		problems []lineError
+	)
+	for _, l := range lines {
+		t, err := l.in.toTodo()
+		if err = joinValidation(l.err, err); err != nil {
+			var invalid validationError
+			if errors.As(err, &invalid) {
+				invalid = invalid.forVersion(versionFromContext(r.Context()))
+				err = invalid
+			}
+			problems = append(problems, lineError{Line: l.line, Message: err.Error(), Fields: invalid})
+			continue
+		}
+		todos = append(todos, t)
+	}
+	if len(problems) > 0 {
+		writeJSON(rw, http.StatusUnprocessableEntity, importErrorResponse{
+			Error: apiError{Code: "invalid_import", Message: fmt.Sprintf("%d of %d todos are invalid, nothing was imported", len(problems), len(lines))},
+			Lines: problems,
+		})
+		return
+	}
+
+	status := http.StatusOK
+	if !dryRun && len(todos) > 0 {
+		if todos, err = store.Import(r.Context(), todos); err != nil {
+			writeStoreError(rw, err)
+			return
+		}
+		status = http.StatusCreated
+	}
+	if todos == nil {
+		todos = []todo{}
+	}
+	writeJSON(rw, status, importResponse{dryRun, len(todos), todos})
+}
+
+type importResponse struct {
+	DryRun   bool
+	Imported int
+	Todos    []todo
+}
+
+// importErrorResponse is the usual error envelope plus what was wrong with every bad line
+type importErrorResponse struct {
+	Error apiError
+	Lines []lineError
+}
+
+func importFormatFor(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return "csv"
+	case "application/json":
+		return "json"
+	case "text/plain":
+		return "todotxt"
+	}
+	return ""
+}
+
+// parseCSVImport wants a header row naming the columns. description is the only one required,
+// done, duedate, priority, project, tags (separated by ;) and recurrence are picked up when present
+// and anything else is ignored, which covers what `todo export --format csv` writes.
+func parseCSVImport(r io.Reader) ([]importLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["description"]; !ok {
+		return nil, errors.New("csv header has no description column")
+	}
+
+	var lines []importLine
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		in := todoInput{
+			Description: field("description"),
+			Duedate:     field("duedate"),
+			Priority:    field("priority"),
+			Project:     field("project"),
+			Recurrence:  field("recurrence"),
+		}
+		if tags := field("tags"); tags != "" {
+			in.Tags = strings.Split(tags, ";")
+		}
+		l := importLine{line: line, in: in}
+		if done := field("done"); done != "" {
+			if l.in.Done, err = strconv.ParseBool(done); err != nil {
+				l.err = validationError{{Field: "done", Reason: reasonWrongType, Message: fmt.Sprintf("done %q is not true or false", done)}}
+			}
+		}
+		lines = append(lines, l)
+	}
+}
+
+// jsonImportRecord is one todo of a json import, in the v1 or the v2 shape. Ids, parents and
+// blockers are read so that todos the api wrote out import as is, and then dropped.
+type jsonImportRecord struct {
+	Description string
+	Done        bool
+	Duedate     string
+	DueDate     string `json:"due_date,omitempty"`
+	Priority    string
+	Tags        []string
+	Project     string
+	Recurrence  string
+
+	ID          json.RawMessage `json:",omitempty"`
+	Parent      json.RawMessage `json:",omitempty"`
+	ParentID    json.RawMessage `json:"parent_id,omitempty"`
+	BlockedBy   json.RawMessage `json:",omitempty"`
+	BlockedByV2 json.RawMessage `json:"blocked_by,omitempty"`
+	Subtasks    json.RawMessage `json:",omitempty"`
+	Links       json.RawMessage `json:"_links,omitempty"`
+}
+
+// parseJSONImport reads an array of todos, each checked on its own like a POST /todos body,
+// so a bad one is an error for its line and the output of `todo export` imports as is
+func parseJSONImport(r io.Reader) ([]importLine, error) {
+	var records []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	lines := make([]importLine, len(records))
+	for i, raw := range records {
+		var rec jsonImportRecord
+		err := decodeObject(raw, &rec, "every todo")
+		if d, err := time.Parse(time.RFC3339, rec.Duedate); err == nil && d.IsZero() {
+			rec.Duedate = "" // how the api writes out todos without a duedate
+		}
+		lines[i] = importLine{line: i + 1, err: err, in: todoInput{
+			Description: rec.Description,
+			Done:        rec.Done,
+			Duedate:     rec.Duedate,
+			DueDate:     rec.DueDate,
+			Priority:    rec.Priority,
+			Tags:        rec.Tags,
+			Project:     rec.Project,
+			Recurrence:  rec.Recurrence,
+		}}
+	}
+	return lines, nil
+}
+
+var (
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	todoTxtRec      = regexp.MustCompile(`^\+?(\d*)([dwmy])$`)
+)
+
+// parseTodoTxtImport reads the todo.txt format (github.com/todotxt/todo.txt): "x" marks done todos,
+// (A) is high, (B) medium and anything below low priority, +project and @context become the project
+// and tags, and the due: and rec: extensions set the duedate and recurrence. Dates in front of the
+// description are creation and completion dates, which todos don't have, so they are dropped.
+func parseTodoTxtImport(r io.Reader) ([]importLine, error) {
+	var lines []importLine
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		in, err := parseTodoTxtLine(words)
+		lines = append(lines, importLine{line: n, in: in, err: err})
+	}
+	return lines, scanner.Err()
+}
+
+func parseTodoTxtLine(words []string) (todoInput, error) {
+	var in todoInput
+	if words[0] == "x" {
+		in.Done = true
+		words = words[1:]
+	} else if m := todoTxtPriority.FindStringSubmatch(words[0]); m != nil {
+		in.Priority = todoTxtPriorityName(m[1])
+		words = words[1:]
+	}
+	for len(words) > 0 && todoTxtDate.MatchString(words[0]) {
+		words = words[1:]
+	}
+
+	var description []string
+	for _, word := range words {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			if in.Project != "" && in.Project != word[1:] {
+				return in, fmt.Errorf("todos have a single project, got +%s and %s", in.Project, word)
+			}
+			in.Project = word[1:]
+		case len(word) > 1 && word[0] == '@':
+			in.Tags = append(in.Tags, word[1:])
+		case strings.HasPrefix(word, "due:"):
+			in.Duedate = strings.TrimPrefix(word, "due:")
+		case strings.HasPrefix(word, "pri:"): // where done todos keep their priority
+			in.Priority = todoTxtPriorityName(strings.TrimPrefix(word, "pri:"))
+		case strings.HasPrefix(word, "rec:"):
+			in.Recurrence = todoTxtRecurrence(strings.TrimPrefix(word, "rec:"))
+		default:
+			description = append(description, word)
+		}
+	}
+	in.Description = strings.Join(description, " ")
+	return in, nil
+}
+
+func todoTxtPriorityName(letter string) string {
+	switch letter {
+	case "A":
+		return "high"
+	case "B":
+		return "medium"
+	}
+	return "low"
+}
+
+// todoTxtRecurrence turns rec:2w into FREQ=WEEKLY;INTERVAL=2. Anything else is passed on as is
+// and fails validation with the usual recurrence error.
+func todoTxtRecurrence(rec string) string {
+	m := todoTxtRec.FindStringSubmatch(rec)
+	if m == nil {
+		return rec
+	}
+	freq := map[string]string{"d": "DAILY", "w": "WEEKLY", "m": "MONTHLY", "y": "YEARLY"}[m[2]]
+	if m[1] == "" || m[1] == "1" {
+		return "FREQ=" + freq
+	}
+	return "FREQ=" + freq + ";INTERVAL=" + m[1]
+}
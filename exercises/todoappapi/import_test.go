@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSVImport(t *testing.T) {
+	// what `todo export --format csv` writes, ids, parents and blockers included
+	lines, err := parseCSVImport(strings.NewReader(`id,description,done,duedate,priority,project,tags,recurrence,parent,blocked_by
+1,buy milk,true,2026-05-01,high,home,errands;food,weekly,,
+2, ,maybe,,,,,,1,1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := todoInput{Description: "buy milk", Done: true, Duedate: "2026-05-01", Priority: "high", Project: "home", Tags: []string{"errands", "food"}, Recurrence: "weekly"}
+	if len(lines) != 2 || lines[0].line != 2 || !reflect.DeepEqual(lines[0].in, want) || lines[0].err != nil {
+		t.Fatalf("got %+v, want line 2 to be %+v", lines, want)
+	}
+	var invalid validationError
+	if lines[1].line != 3 || !errors.As(lines[1].err, &invalid) || len(invalid) != 1 || invalid[0].Field != "done" || invalid[0].Reason != reasonWrongType {
+		t.Errorf("line 3: %+v, want a wrong_type done", lines[1])
+	}
+
+	for _, in := range []string{"", "description\n"} {
+		if lines, err := parseCSVImport(strings.NewReader(in)); err != nil || len(lines) != 0 {
+			t.Errorf("%q: got %+v, %v, want nothing", in, lines, err)
+		}
+	}
+	if _, err := parseCSVImport(strings.NewReader("title,done\nx,true\n")); err == nil {
+		t.Error("a header without description was accepted")
+	}
+}
+
+func TestParseTodoTxtLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want todoInput
+		err  bool
+	}{
+		{"x 2026-01-02 2026-01-01 pay rent +home @money due:2026-02-01 pri:A rec:1m",
+			todoInput{Description: "pay rent", Done: true, Priority: "high", Project: "home", Tags: []string{"money"}, Duedate: "2026-02-01", Recurrence: "FREQ=MONTHLY"}, false},
+		{"(B) call mum @phone @family", todoInput{Description: "call mum", Priority: "medium", Tags: []string{"phone", "family"}}, false},
+		{"(D) 2026-01-01 water the plants +home +home rec:2w", todoInput{Description: "water the plants", Priority: "low", Project: "home", Recurrence: "FREQ=WEEKLY;INTERVAL=2"}, false},
+		{"(a) + @ not a priority", todoInput{Description: "(a) + @ not a priority"}, false},
+		{"read +books +films", todoInput{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTodoTxtLine(strings.Fields(tt.line))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: got %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestTodoTxtRecurrence(t *testing.T) {
+	tests := map[string]string{
+		"d":   "FREQ=DAILY",
+		"1w":  "FREQ=WEEKLY",
+		"+3m": "FREQ=MONTHLY;INTERVAL=3",
+		"2y":  "FREQ=YEARLY;INTERVAL=2",
+		"5q":  "5q",
+		"":    "",
+	}
+	for in, want := range tests {
+		if got := todoTxtRecurrence(in); got != want {
+			t.Errorf("todoTxtRecurrence(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestImportEndpoint(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	post := func(query, contentType, body string, into any) int {
+		t.Helper()
+		res, err := http.Post(srv.URL+"/todos/import"+query, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if err := json.NewDecoder(res.Body).Decode(into); err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode
+	}
+	count := func() int {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/todos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var todos []json.RawMessage
+		json.NewDecoder(res.Body).Decode(&todos)
+		return len(todos)
+	}
+	type importErr struct {
+		Lines []struct {
+			Line    int
+			Message string
+			Fields  []fieldError
+		}
+	}
+	fieldsOf := func(e importErr) string {
+		var lines []string
+		for _, l := range e.Lines {
+			var fields []string
+			for _, f := range l.Fields {
+				fields = append(fields, f.Field+" "+f.Reason)
+			}
+			lines = append(lines, fmt.Sprintf("%d: %s", l.Line, cmp.Or(strings.Join(fields, ", "), l.Message)))
+		}
+		return strings.Join(lines, "; ")
+	}
+
+	var bad importErr
+	status := post("", "application/json", `[
+		{"Description": "fine"},
+		{"Description": "wrong type", "Done": "yes"},
+		{"Description": "", "Colour": "red"},
+		"not a todo"]`, &bad)
+	want := "2: Done wrong_type; 3: Colour unknown_field, Description required; 4: every todo has to be a json object"
+	if status != http.StatusUnprocessableEntity || fieldsOf(bad) != want {
+		t.Errorf("bad json: got %d %s, want 422 %s", status, fieldsOf(bad), want)
+	}
+
+	bad = importErr{}
+	status = post("?format=csv", "", "description,done\nfine,false\n,maybe\n", &bad)
+	if want := "3: Done wrong_type, Description required"; status != http.StatusUnprocessableEntity || fieldsOf(bad) != want {
+		t.Errorf("bad csv: got %d %s, want 422 %s", status, fieldsOf(bad), want)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("rejected imports left %d todos behind", n)
+	}
+
+	// v1 and v2 shapes, with what the api writes besides, import the same
+	good := `[{"Id": 7, "Description": "v1", "Duedate": "0001-01-01T00:00:00Z", "Parent": null, "BlockedBy": []},
+		{"id": 8, "description": "v2", "due_date": "2026-05-01", "priority": "high", "parent_id": null, "_links": {}}]`
+	var res struct {
+		DryRun   bool
+		Imported int
+		Todos    []struct{ Description, Duedate, Priority string }
+	}
+	if status := post("?dry_run=true", "application/json", good, &res); status != http.StatusOK || !res.DryRun || res.Imported != 2 {
+		t.Errorf("dry run: got %d %+v", status, res)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("a dry run wrote %d todos", n)
+	}
+	if status := post("", "application/json", good, &res); status != http.StatusCreated || res.Imported != 2 {
+		t.Fatalf("import: got %d %+v", status, res)
+	}
+	if v2 := res.Todos[1]; !strings.HasPrefix(v2.Duedate, "2026-05-01") || v2.Priority != "high" {
+		t.Errorf("the v2 keys were dropped: %+v", v2)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("%d todos after the import, want 2", n)
+	}
+
+	todotxt := "x done already\n\n(A) call the bank +money due:2026-03-01\n"
+	if status := post("", "text/plain", todotxt, &res); status != http.StatusCreated || res.Imported != 2 || res.Todos[1].Priority != "high" {
+		t.Errorf("todo.txt import: got %d %+v", status, res)
+	}
+}
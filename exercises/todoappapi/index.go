@@ -1,34 +1,34 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 )
 
+// GET /todos takes optional priority, project and (repeatable) tag query params, e.g.
+// /todos?priority=high&project=home&tag=pets&tag=outdoors
 func index(rw http.ResponseWriter, r *http.Request) {
-	var todos []todo
-	rw.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
 
-	rows, err := db.Query(`SELECT * FROM todos`)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var todo todo
-		if err := rows.Scan(&todo.id, &todo.description, &todo.done, &todo.duedate); err != nil {
-			log.Fatal(err)
+	var filter todoFilter
+	if query.Has("priority") {
+		p, err := parsePriority(query.Get("priority"))
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, "invalid_filter", err.Error())
+			return
 		}
-		todos = append(todos, todo)
+		filter.priority = &p
 	}
+	filter.project = query.Get("project")
+	filter.tags = query["tag"]
 
-	res, err := json.Marshal(todos)
+	todos, err := store.List(r.Context(), filter)
 	if err != nil {
-		log.Fatal(err)
+		writeInternalError(rw, err)
+		return
+	}
+	if todos == nil {
+		todos = []todo{} // [] instead of null when nothing matches
 	}
 
-	fmt.Fprintln(rw, string(res))
+	writeJSON(rw, http.StatusOK, todos)
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIndexFilters(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	for _, body := range []string{
+		`{"Description": "fix the roof", "Priority": "high", "Project": "house", "Tags": ["outside"]}`,
+		`{"Description": "paint the door", "Priority": "low", "Project": "house", "Tags": ["outside", "weekend"]}`,
+		`{"Description": "call the bank", "Priority": "high"}`,
+	} {
+		res, err := http.Post(srv.URL+"/todos", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{"fix the roof", "paint the door", "call the bank"}},
+		{"?priority=high", http.StatusOK, []string{"fix the roof", "call the bank"}},
+		{"?priority=", http.StatusOK, []string{}},
+		{"?project=house&priority=low", http.StatusOK, []string{"paint the door"}},
+		{"?tag=outside&tag=weekend", http.StatusOK, []string{"paint the door"}},
+		{"?project=garden", http.StatusOK, []string{}},
+		{"?priority=urgent", http.StatusBadRequest, nil},
+		{"?priority=HIGH", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		res, err := http.Get(srv.URL + "/todos" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body json.RawMessage
+		json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("GET /todos%s: %d %s, want %d", tt.query, res.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			var e errorResponse
+			if json.Unmarshal(body, &e); e.Error.Code != "invalid_filter" {
+				t.Errorf("GET /todos%s: %s, want invalid_filter", tt.query, body)
+			}
+			continue
+		}
+		var todos []struct{ Description string }
+		json.Unmarshal(body, &todos)
+		got := []string{}
+		for _, td := range todos {
+			got = append(got, td.Description)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /todos%s: %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
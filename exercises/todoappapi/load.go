@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// `go run . load` finds out how much the api takes. It sends a mix of list, show, create and
+// delete requests at a steady rate from a pool of workers and prints latency percentiles and
+// error rates per kind of request. Without -url it starts the api in-process on a random port,
+// with whatever TODOAPP_* settings are in the environment, so the numbers include the whole
+// middleware stack but no network.
+//
+//	TODOAPP_STORE=memory go run . load -rate 500 -duration 30s
+//	go run . load -url http://localhost:5050 -mix list=80,create=20 -rate 0
+func loadTest(cfg config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+	target := flags.String("url", "", "api to load, empty starts one in-process")
+	apiKey := flags.String("api-key", cfg.apiKey, "sent as a bearer token when set")
+	rate := flags.Float64("rate", 100, "requests per second to aim for, 0 sends as fast as the workers can")
+	duration := flags.Duration("duration", 10*time.Second, "how long to send requests for")
+	workers := flags.Int("workers", 10, "how many requests can be in flight at once")
+	mixFlag := flags.String("mix", "list=40,show=40,create=15,delete=5", "relative weight of every kind of request")
+	prefill := flags.Int("prefill", 100, "todos to create before the clock starts, so show and delete have something to work on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *rate < 0:
+		return errors.New("load: -rate can't be negative")
+	case *duration <= 0:
+		return errors.New("load: -duration has to be positive")
+	case *workers < 1:
+		return errors.New("load: -workers has to be at least 1")
+	}
+	mix, err := parseLoadMix(*mixFlag)
+	if err != nil {
+		return fmt.Errorf("load: -mix: %w", err)
+	}
+
+	if *target == "" {
+		srv, err := startInProcess(cfg)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+		*target = srv.URL
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	l := &loader{
+		target: strings.TrimSuffix(*target, "/"),
+		apiKey: *apiKey,
+		http:   &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: *workers}},
+	}
+	for range *prefill {
+		if _, err := l.create(ctx); err != nil {
+			return fmt.Errorf("load: prefill: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+	res := l.run(ctx, mix, *rate, *workers)
+	res.print(out, *rate)
+	return nil
+}
+
+// startInProcess serves the api the way main does, minus grpc and reminders, on a random port
+func startInProcess(cfg config) (*httptest.Server, error) {
+	// the access log line of every request would drown the report
+	slog.SetDefault(slog.New(traceLogHandler{slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})}))
+
+	exporter, err := newExporter(cfg.traceExporter)
+	if err != nil {
+		return nil, err
+	}
+	tracer := newTracer(exporter)
+	setupStore(cfg, openStore(cfg), tracer)
+	return httptest.NewServer(newHandler(cfg, tracer)), nil
+}
+
+type loadOp string
+
+const (
+	opList   loadOp = "list"
+	opShow   loadOp = "show"
+	opCreate loadOp = "create"
+	opDelete loadOp = "delete"
+)
+
+var loadOps = []loadOp{opList, opShow, opCreate, opDelete}
+
+// loadMix is how often every kind of request gets picked, relative to the others
+type loadMix map[loadOp]int
+
+// parseLoadMix reads list=40,show=40,create=15,delete=5. Kinds that are left out are never sent.
+func parseLoadMix(s string) (loadMix, error) {
+	mix := loadMix{}
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not kind=weight", part)
+		}
+		op := loadOp(name)
+		if !slices.Contains(loadOps, op) {
+			return nil, fmt.Errorf("unknown request kind %q, expected list, show, create or delete", name)
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("weight of %s has to be a number of at least 0", name)
+		}
+		mix[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("every weight is 0")
+	}
+	return mix, nil
+}
+
+func (m loadMix) pick() loadOp {
+	total := 0
+	for _, w := range m {
+		total += w
+	}
+	n := rand.IntN(total)
+	for _, op := range loadOps { // a fixed order, ranging over the map would change the odds between runs
+		if n < m[op] {
+			return op
+		}
+		n -= m[op]
+	}
+	panic("unreachable")
+}
+
+// loader sends the requests. ids is every todo it knows to exist, show picks from them and
+// delete takes them away.
+type loader struct {
+	target string
+	apiKey string
+	http   *http.Client
+
+	mu  sync.Mutex
+	ids []int
+}
+
+// do runs one request of kind op, a nil error means a 2xx answer
+func (l *loader) do(ctx context.Context, op loadOp) error {
+	switch op {
+	case opList:
+		return l.send(ctx, http.MethodGet, "/todos", nil, nil)
+	case opShow:
+		id, ok := l.anyID(false)
+		if !ok {
+			return l.send(ctx, http.MethodGet, "/todos", nil, nil) // nothing to show, list instead
+		}
+		return l.send(ctx, http.MethodGet, "/todos/"+strconv.Itoa(id), nil, nil)
+	case opCreate:
+		_, err := l.create(ctx)
+		return err
+	case opDelete:
+		id, ok := l.anyID(true)
+		if !ok {
+			_, err := l.create(ctx) // keeps the request rate up until there is something to delete
+			return err
+		}
+		return l.send(ctx, http.MethodDelete, "/todos/"+strconv.Itoa(id), nil, nil)
+	}
+	return fmt.Errorf("unknown request kind %q", op)
+}
+
+func (l *loader) create(ctx context.Context) (int, error) {
+	var created struct{ Id int }
+	body := fmt.Appendf(nil, `{"Description":"load test todo %d","Priority":"low","Tags":["load"]}`, rand.IntN(1_000_000))
+	if err := l.send(ctx, http.MethodPost, "/todos", body, &created); err != nil {
+		return 0, err
+	}
+	l.mu.Lock()
+	l.ids = append(l.ids, created.Id)
+	l.mu.Unlock()
+	return created.Id, nil
+}
+
+// anyID picks one of the known todos, take removes it so no two deletes go for the same one
+func (l *loader) anyID(take bool) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.ids) == 0 {
+		return 0, false
+	}
+	i := rand.IntN(len(l.ids))
+	id := l.ids[i]
+	if take {
+		l.ids[i] = l.ids[len(l.ids)-1]
+		l.ids = l.ids[:len(l.ids)-1]
+	}
+	return id, true
+}
+
+func (l *loader) send(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, l.target+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if l.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+l.apiKey)
+	}
+
+	resp, err := l.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body) // read to the end so the connection gets reused
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// loadResult is what every worker keeps for itself and what they add up to at the end
+type loadResult struct {
+	elapsed   time.Duration
+	skipped   int // requests the rate asked for while every worker was busy
+	latencies map[loadOp][]time.Duration
+	errors    map[loadOp]int
+}
+
+func newLoadResult() *loadResult {
+	return &loadResult{latencies: map[loadOp][]time.Duration{}, errors: map[loadOp]int{}}
+}
+
+func (r *loadResult) add(other *loadResult) {
+	for op, ls := range other.latencies {
+		r.latencies[op] = append(r.latencies[op], ls...)
+	}
+	for op, n := range other.errors {
+		r.errors[op] += n
+	}
+}
+
+// run keeps sending until ctx is done. With a rate the requests are handed to the workers on a
+// fixed schedule, a request whose turn comes while all of them are busy is skipped instead of
+// queued, so a slow api shows up as a lower achieved rate and not as a growing backlog.
+func (l *loader) run(ctx context.Context, mix loadMix, rate float64, workers int) *loadResult {
+	jobs := make(chan loadOp)
+	results := make([]*loadResult, workers)
+	var wg sync.WaitGroup
+	for i := range results {
+		results[i] = newLoadResult()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range jobs {
+				start := time.Now()
+				err := l.do(ctx, op)
+				if ctx.Err() != nil {
+					return // cut off by the end of the run, says nothing about the api
+				}
+				results[i].latencies[op] = append(results[i].latencies[op], time.Since(start))
+				if err != nil {
+					results[i].errors[op]++
+				}
+			}
+		}()
+	}
+
+	res := newLoadResult()
+	start := time.Now()
+	interval := time.Duration(0)
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+dispatch:
+	for n := 0; ; n++ {
+		op := mix.pick()
+		if interval == 0 {
+			select {
+			case jobs <- op:
+			case <-ctx.Done():
+				break dispatch
+			}
+			continue
+		}
+
+		select {
+		case <-time.After(time.Until(start.Add(time.Duration(n) * interval))):
+		case <-ctx.Done():
+			break dispatch
+		}
+		select {
+		case jobs <- op:
+		default:
+			res.skipped++
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	res.elapsed = time.Since(start)
+	for _, r := range results {
+		res.add(r)
+	}
+	return res
+}
+
+func (r *loadResult) print(out io.Writer, rate float64) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "request\trequests\terrors\terror rate\tp50\tp90\tp99\tmax\t")
+
+	var all []time.Duration
+	errs := 0
+	for _, op := range loadOps {
+		if len(r.latencies[op]) == 0 {
+			continue
+		}
+		all = append(all, r.latencies[op]...)
+		errs += r.errors[op]
+		printLoadRow(w, string(op), r.latencies[op], r.errors[op])
+	}
+	printLoadRow(w, "total", all, errs)
+	w.Flush()
+
+	target := "as fast as possible"
+	if rate > 0 {
+		target = fmt.Sprintf("aimed for %.1f/s", rate)
+	}
+	fmt.Fprintf(out, "\n%.1f requests/s over %s, %s\n", float64(len(all))/r.elapsed.Seconds(), r.elapsed.Round(time.Millisecond), target)
+	if r.skipped > 0 {
+		fmt.Fprintf(out, "%d requests skipped because every worker was busy, try more -workers or a lower -rate\n", r.skipped)
+	}
+}
+
+func printLoadRow(w io.Writer, name string, latencies []time.Duration, errs int) {
+	if len(latencies) == 0 {
+		fmt.Fprintf(w, "%s\t0\t0\t-\t-\t-\t-\t-\t\n", name)
+		return
+	}
+	slices.Sort(latencies)
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%s\t%s\t%s\t%s\t\n", name, len(latencies), errs,
+		100*float64(errs)/float64(len(latencies)),
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1].Round(time.Microsecond))
+}
+
+// percentile of sorted latencies, nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (p*len(sorted)+99)/100 - 1
+	return sorted[max(i, 0)].Round(time.Microsecond)
+}
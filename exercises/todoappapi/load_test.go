@@ -0,0 +1,83 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(ns ...int) []time.Duration {
+		var ds []time.Duration
+		for _, n := range ns {
+			ds = append(ds, time.Duration(n)*time.Millisecond)
+		}
+		return ds
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		hundred[i] = i + 1
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{ms(hundred...), 50, 50 * time.Millisecond},
+		{ms(hundred...), 90, 90 * time.Millisecond},
+		{ms(hundred...), 99, 99 * time.Millisecond},
+		{ms(hundred...), 100, 100 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 50, 5 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 90, 9 * time.Millisecond},
+		{ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 99, 10 * time.Millisecond}, // nearest rank rounds up
+		{ms(1, 2, 3), 50, 2 * time.Millisecond},
+		{ms(7), 50, 7 * time.Millisecond},
+		{ms(7), 99, 7 * time.Millisecond},
+		{ms(1, 2), 0, 1 * time.Millisecond},
+		{[]time.Duration{1234567 * time.Nanosecond}, 50, 1235 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("p%d of %d latencies: %s, want %s", tt.p, len(tt.sorted), got, tt.want)
+		}
+	}
+}
+
+func TestParseLoadMix(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    loadMix
+		wantErr bool
+	}{
+		{"list=40,show=40,create=15,delete=5", loadMix{opList: 40, opShow: 40, opCreate: 15, opDelete: 5}, false},
+		{" list=1 , create=0", loadMix{opList: 1, opCreate: 0}, false},
+		{"list", nil, true},
+		{"update=5", nil, true},
+		{"list=-1", nil, true},
+		{"list=lots", nil, true},
+		{"list=0,show=0", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLoadMix(tt.in)
+		if (err != nil) != tt.wantErr || !maps.Equal(got, tt.want) {
+			t.Errorf("parseLoadMix(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestLoadMixPick(t *testing.T) {
+	mix := loadMix{opList: 3, opCreate: 1, opDelete: 0}
+	counts := map[loadOp]int{}
+	const n = 20000
+	for range n {
+		counts[mix.pick()]++
+	}
+	if counts[opShow] != 0 || counts[opDelete] != 0 {
+		t.Errorf("picked kinds with no weight: %v", counts)
+	}
+	// 3 in 4 should be lists, give or take a lot more than chance would
+	if share := float64(counts[opList]) / n; share < 0.7 || share > 0.8 {
+		t.Errorf("list got %.2f of the requests, want about 0.75", share)
+	}
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
@@ -18,18 +26,131 @@ const (
 	dbname   = "postgres"
 )
 
-var db *sql.DB
+var (
+	db    *sql.DB
+	store todoStore
+)
 
 func main() {
+	slog.SetDefault(slog.New(traceLogHandler{slog.NewTextHandler(os.Stderr, nil)}))
+	cfg := loadConfig()
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd(cfg, os.Args[2:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	exporter, err := newExporter(cfg.traceExporter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracer := newTracer(exporter)
+
+	base := openStore(cfg)
+	startReminders(cfg, base, tracer)
+	feed := setupStore(cfg, base, tracer)
+
+	tlsCfg, err := loadTLS(cfg.tls)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.grpcAddr != "" {
+		go serveGRPC(cfg.grpcAddr, newGRPCServer(cfg, tlsCfg, tracer, store, feed))
+	}
+	listenAndServe(newHandler(cfg, tracer), tlsCfg)
+}
+
+// subcommands run instead of the api with `go run . <name>`
+var subcommands = map[string]func(cfg config, args []string, out io.Writer) error{
+	"seed":    seed,
+	"load":    loadTest,
+	"export":  exportCommand,
+	"restore": restoreCommand,
+}
+
+// setupStore puts the tracing, cache and event layers on top of base and makes the result
+// the store the handlers use
+func setupStore(cfg config, base todoStore, tracer *tracer) *changeFeed {
+	var cached todoStore = newTracingStore(base, tracer)
+	if cfg.cacheSize > 0 {
+		cached = newCacheStore(cached, cfg.cacheSize, cfg.cacheTTL)
+	}
+	feed := newChangeFeed()
+	store = newEventStore(cached, feed)
+	return feed
+}
+
+// newHandler is the whole REST api, router and the middleware around it
+func newHandler(cfg config, tracer *tracer) http.Handler {
+	handler := negotiateVersion(newRouter(cfg, tracer))
+	if len(cfg.cors.origins) > 0 {
+		handler = cors(cfg.cors, handler)
+	}
+	return traceRequests(tracer, handler)
+}
+
+func newRouter(cfg config, tracer *tracer) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(tracer.traceHandler)
+	if cfg.apiKey != "" && len(cfg.workspaceKeys) == 0 {
+		router.Use(requireAPIKey(cfg.apiKey))
+	}
+	router.Use(scopeToWorkspace(cfg))
+	if cfg.idempotencyWindow > 0 {
+		router.Use(newIdempotencyCache(cfg.idempotencyWindow).middleware)
+	}
 
 	router.HandleFunc("/", func(_ http.ResponseWriter, _ *http.Request) {})
 	router.HandleFunc("/todos", index).Methods("GET")
+	router.HandleFunc("/todos", create).Methods("POST")
+	router.HandleFunc("/todos/search", search).Methods("GET") // has to come before /todos/{id}
+	router.HandleFunc("/todos/import", importTodos).Methods("POST")
+	router.HandleFunc("/todos/stats", stats).Methods("GET")
+	router.HandleFunc("/todos/archive", exportArchive).Methods("GET")
+	router.HandleFunc("/todos/archive", restoreArchive(cfg)).Methods("PUT")
 	router.HandleFunc("/todos/{id}", show).Methods("GET")
-	router.HandleFunc("/todos/{id}", delete).Methods("DELETE")
+	router.HandleFunc("/todos/{id}", destroy).Methods("DELETE")
+	router.HandleFunc("/todos/{id}/done", done).Methods("POST")
+	router.HandleFunc("/todos/{id}/parent/{parent}", setParent).Methods("PUT")
+	router.HandleFunc("/todos/{id}/parent", clearParent).Methods("DELETE")
+	router.HandleFunc("/todos/{id}/blockers/{blocker}", addBlocker).Methods("PUT")
+	router.HandleFunc("/todos/{id}/blockers/{blocker}", removeBlocker).Methods("DELETE")
+	router.Handle("/graphql", newGraphQLHandler(store)).Methods("POST")
+	router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
+	return router
+}
 
-	initDBConn()
-	listenAndServe(router)
+// openStore sets up the storage layer picked by TODOAPP_STORE. The memory store is empty on every start,
+// the sqlite one migrates its file on startup, postgres expects `make migrate` to have run.
+func openStore(cfg config) todoStore {
+	switch cfg.store {
+	case "postgres":
+		initDBConn()
+		s, err := newPostgresStore(db, cfg.pool, cfg.postgresRLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return s
+	case "sqlite":
+		var err error
+		if db, err = openSQLite(cfg.sqlitePath); err != nil {
+			log.Fatal(err)
+		}
+		s, err := newSQLiteStore(db, cfg.pool)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return s
+	case "memory":
+		return newMemoryStore()
+	}
+	log.Fatalf("unknown store %q, expected postgres, sqlite or memory", cfg.store)
+	return nil
 }
 
 func initDBConn() {
@@ -43,8 +164,32 @@ func initDBConn() {
 	}
 }
 
-func listenAndServe(router *mux.Router) {
-	if err := http.ListenAndServe(":5050", router); err != nil {
+// startReminders runs the due date reminder scheduler in the background,
+// TODOAPP_REMINDER_INTERVAL=0 turns it off
+func startReminders(cfg config, base todoStore, tracer *tracer) {
+	if cfg.reminderInterval <= 0 {
+		return
+	}
+	rs, ok := base.(reminderStore)
+	if !ok {
+		log.Print("reminders: the configured store cannot track reminders, not starting the scheduler")
+		return
+	}
+	n, err := newNotifier(cfg)
+	if err != nil {
 		log.Fatal(err)
 	}
+	go newReminderScheduler(rs, n, cfg.reminderInterval, cfg.reminderLead, tracer).run(context.Background())
+}
+
+// listenAndServe serves plain http/1.1, or https with http/2 when tlsCfg is set
+func listenAndServe(handler http.Handler, tlsCfg *tls.Config) {
+	srv := &http.Server{Addr: ":5050", Handler: handler, TLSConfig: tlsCfg}
+	var err error
+	if tlsCfg != nil {
+		err = srv.ListenAndServeTLS("", "") // the certificates come from tlsCfg
+	} else {
+		err = srv.ListenAndServe()
+	}
+	log.Fatal(err)
 }
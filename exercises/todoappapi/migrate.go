@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Postgres migrations live in migrations/ and are applied by `make migrate`, the sqlite
+// flavour of every one of them lives in migrations/sqlite/ under the same name
+//
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrate applies every migration in dir that is not in schema_migrations yet, one transaction each.
+// It refuses to run if dir does not have the same set of versions as the postgres migrations.
+// That the versions make the same tables and columns is up to TestMigrationsMatch.
+func migrate(db *sql.DB, dir string) error {
+	want, err := migrationVersions("migrations")
+	if err != nil {
+		return err
+	}
+	versions, err := migrationVersions(dir)
+	if err != nil {
+		return err
+	}
+	if strings.Join(want, ",") != strings.Join(versions, ",") {
+		return fmt.Errorf("%s has migrations %v, expected the same as migrations/: %v", dir, versions, want)
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version text PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		var applied bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join(dir, version+".sql"))
+		if err != nil {
+			return err
+		}
+		if err := applyMigration(db, version, string(body)); err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+		log.Printf("applied migration %s...", version)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version, body string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(body); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrationVersions(dir string) ([]string, error) {
+	files, err := fs.Glob(migrationFiles, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, len(files))
+	for i, f := range files {
+		versions[i] = strings.TrimSuffix(path.Base(f), ".sql")
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
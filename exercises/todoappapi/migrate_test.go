@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// The postgres and sqlite migrations are two hand written sets and migrate only checks that they
+// have the same versions. This checks that they end up with the same tables and columns too.
+// Full text search is where they differ on purpose: a generated column in postgres, an fts5
+// table in sqlite.
+func TestMigrationsMatch(t *testing.T) {
+	lite := schemaColumns(t, openTestSQLite(t).db.DB, `
+SELECT m.name || '.' || p.name FROM sqlite_master m, pragma_table_info(m.name) p
+WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' AND m.name NOT LIKE 'todos_fts%'`)
+	pg := schemaColumns(t, openTestPostgres(t), `
+SELECT table_name || '.' || column_name FROM information_schema.columns
+WHERE table_schema = current_schema() AND NOT (table_name = 'todos' AND column_name = 'search')`)
+
+	for _, col := range pg {
+		if !slices.Contains(lite, col) {
+			t.Errorf("%s is only in the postgres schema", col)
+		}
+	}
+	for _, col := range lite {
+		if !slices.Contains(pg, col) {
+			t.Errorf("%s is only in the sqlite schema", col)
+		}
+	}
+}
+
+// TestModelMatchesSchema migrates a fresh database and fails when a field of todo isn't read
+// by the store, or the todos table has a column the store doesn't read or lacks one it does.
+// subtasks aren't a column, Tree puts them together from parent_id.
+func TestModelMatchesSchema(t *testing.T) {
+	var model []string
+	typ := reflect.TypeFor[todo]()
+	for i := range typ.NumField() {
+		if name := typ.Field(i).Name; name != "subtasks" {
+			model = append(model, name)
+		}
+	}
+
+	stores := []struct {
+		name           string
+		open           func(t *testing.T) *sql.DB
+		tableColumns   string
+		fields, mapped []string
+		unmapped       []string
+	}{
+		{"sqlite", func(t *testing.T) *sql.DB { return openTestSQLite(t).db.DB }, sqliteTableColumns,
+			sqliteTodoColumns.fields(), sqliteTodoColumns.columns(), sqliteUnmappedColumns},
+		{"postgres", func(t *testing.T) *sql.DB { return openTestPostgres(t) }, postgresTableColumns,
+			postgresTodoColumns.fields(), postgresTodoColumns.columns(), postgresUnmappedColumns},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			for _, f := range model {
+				if !slices.Contains(s.fields, f) {
+					t.Errorf("todo.%s isn't read from the database", f)
+				}
+			}
+			for _, f := range s.fields {
+				if !slices.Contains(model, f) {
+					t.Errorf("the store reads into %s, todo has no such field", f)
+				}
+			}
+
+			missing, extra, err := schemaDiff(context.Background(), s.open(t), s.tableColumns, s.mapped, s.unmapped)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, col := range missing {
+				t.Errorf("the store reads todos.%s, the migrations don't make it", col)
+			}
+			for _, col := range extra {
+				t.Errorf("the migrations make todos.%s, the store doesn't read it", col)
+			}
+		})
+	}
+}
+
+// schemaColumns runs a query that lists table.column names
+func schemaColumns(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			t.Fatal(err)
+		}
+		cols = append(cols, col)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(cols) == 0 {
+		t.Fatal("the migrations made no tables")
+	}
+	return cols
+}
@@ -0,0 +1,54 @@
+-- the seed rows in 0001 insert explicit ids, so the sequence has to catch up
+-- before anything is inserted through the api
+SELECT setval('todos_id_seq', (SELECT MAX(id) FROM todos));
+
+CREATE TABLE
+  public.projects (
+    id serial NOT NULL,
+    name text NOT NULL
+  );
+
+ALTER TABLE
+  public.projects
+ADD
+  CONSTRAINT projects_pkey PRIMARY KEY (id),
+ADD
+  CONSTRAINT projects_name_key UNIQUE (name);
+
+CREATE TABLE
+  public.tags (
+    id serial NOT NULL,
+    name text NOT NULL
+  );
+
+ALTER TABLE
+  public.tags
+ADD
+  CONSTRAINT tags_pkey PRIMARY KEY (id),
+ADD
+  CONSTRAINT tags_name_key UNIQUE (name);
+
+CREATE TABLE
+  public.todo_tags (
+    todo_id integer NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    tag_id integer NOT NULL REFERENCES public.tags (id) ON DELETE CASCADE
+  );
+
+ALTER TABLE
+  public.todo_tags
+ADD
+  CONSTRAINT todo_tags_pkey PRIMARY KEY (todo_id, tag_id);
+
+-- priority is stored as a small integer, 0 (none) to 3 (high)
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN priority smallint NOT NULL DEFAULT 0,
+ADD
+  COLUMN project_id integer NULL REFERENCES public.projects (id) ON DELETE SET NULL;
+
+INSERT INTO "projects" ("name") VALUES ('home');
+UPDATE "todos" SET "priority" = 2, "project_id" = (SELECT "id" FROM "projects" WHERE "name" = 'home') WHERE "id" = 1;
+
+INSERT INTO "tags" ("name") VALUES ('pets');
+INSERT INTO "todo_tags" ("todo_id", "tag_id") VALUES (1, (SELECT "id" FROM "tags" WHERE "name" = 'pets'));
@@ -0,0 +1,5 @@
+-- recurrence holds an RRULE like FREQ=WEEKLY;BYDAY=MO, NULL for one-off todos
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN recurrence text NULL;
@@ -0,0 +1,20 @@
+-- deleting a parent deletes its subtasks with it
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN parent_id integer NULL REFERENCES public.todos (id) ON DELETE CASCADE;
+
+CREATE INDEX todos_parent_id_idx ON public.todos (parent_id);
+
+-- todo_id cannot be done until blocked_by_id is done
+CREATE TABLE
+  public.todo_blockers (
+    todo_id integer NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    blocked_by_id integer NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    CONSTRAINT todo_blockers_not_self CHECK (todo_id <> blocked_by_id)
+  );
+
+ALTER TABLE
+  public.todo_blockers
+ADD
+  CONSTRAINT todo_blockers_pkey PRIMARY KEY (todo_id, blocked_by_id);
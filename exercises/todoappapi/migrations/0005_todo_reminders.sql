@@ -0,0 +1,14 @@
+-- one row per reminder sent, so a restart doesn't send the same reminder again.
+-- duedate is part of the key because moving a todo's duedate deserves a fresh reminder.
+CREATE TABLE
+  public.todo_reminders (
+    todo_id integer NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    kind text NOT NULL,
+    duedate date NOT NULL,
+    sent_at timestamptz NOT NULL DEFAULT now()
+  );
+
+ALTER TABLE
+  public.todo_reminders
+ADD
+  CONSTRAINT todo_reminders_pkey PRIMARY KEY (todo_id, kind, duedate);
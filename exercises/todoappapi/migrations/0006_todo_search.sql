@@ -0,0 +1,7 @@
+-- keeping the tsvector in a generated column means the GIN index can't drift from description
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN search tsvector GENERATED ALWAYS AS (to_tsvector('english', description)) STORED;
+
+CREATE INDEX todos_search_idx ON public.todos USING GIN (search);
@@ -0,0 +1,25 @@
+-- created_at and done_at are what GET /todos/stats works out time to done and the weekly
+-- completions from. The trigger keeps done_at in step with done whichever query flips it.
+-- Todos that were done before this migration never get a done_at, the stats skip them.
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN created_at timestamptz NOT NULL DEFAULT now(),
+ADD
+  COLUMN done_at timestamptz NULL;
+
+CREATE FUNCTION public.todos_set_done_at() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT NEW.done THEN
+    NEW.done_at := NULL;
+  ELSIF TG_OP = 'INSERT' OR NOT OLD.done THEN
+    NEW.done_at := now();
+  END IF;
+  RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER todos_done_at BEFORE INSERT OR UPDATE OF done ON public.todos
+FOR EACH ROW EXECUTE FUNCTION public.todos_set_done_at();
+
+CREATE INDEX todos_done_at_idx ON public.todos (done_at) WHERE done_at IS NOT NULL;
@@ -0,0 +1,43 @@
+-- Every todo belongs to a workspace, and the store only ever looks at the todos of the
+-- workspace a request is for. Existing todos end up in the default one.
+ALTER TABLE
+  public.todos
+ADD
+  COLUMN workspace text NOT NULL DEFAULT 'default';
+
+CREATE INDEX todos_workspace_idx ON public.todos (workspace, id);
+
+-- With TODOAPP_POSTGRES_RLS=true the api also has postgres check the scoping: every query runs
+-- as todoapp_workspace, with the workspace in the todoapp.workspace setting, and these policies
+-- hide everything else. The table owner the api connects as isn't subject to them otherwise.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'todoapp_workspace') THEN
+    CREATE ROLE todoapp_workspace NOLOGIN;
+  END IF;
+END
+$$;
+
+GRANT todoapp_workspace TO CURRENT_USER;
+GRANT SELECT, INSERT, UPDATE, DELETE ON public.todos, public.todo_tags, public.todo_blockers, public.todo_reminders TO todoapp_workspace;
+GRANT SELECT, INSERT, UPDATE ON public.projects, public.tags TO todoapp_workspace;
+GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO todoapp_workspace;
+
+ALTER TABLE public.todos ENABLE ROW LEVEL SECURITY;
+CREATE POLICY todos_workspace ON public.todos TO todoapp_workspace
+  USING (workspace = current_setting('todoapp.workspace', true))
+  WITH CHECK (workspace = current_setting('todoapp.workspace', true));
+
+-- the link tables have no workspace of their own, a row is visible when its todo is
+ALTER TABLE public.todo_tags ENABLE ROW LEVEL SECURITY;
+CREATE POLICY todo_tags_workspace ON public.todo_tags TO todoapp_workspace
+  USING (EXISTS (SELECT 1 FROM public.todos t WHERE t.id = todo_id));
+
+ALTER TABLE public.todo_blockers ENABLE ROW LEVEL SECURITY;
+CREATE POLICY todo_blockers_workspace ON public.todo_blockers TO todoapp_workspace
+  USING (EXISTS (SELECT 1 FROM public.todos t WHERE t.id = todo_id)
+    AND EXISTS (SELECT 1 FROM public.todos t WHERE t.id = blocked_by_id));
+
+ALTER TABLE public.todo_reminders ENABLE ROW LEVEL SECURITY;
+CREATE POLICY todo_reminders_workspace ON public.todo_reminders TO todoapp_workspace
+  USING (EXISTS (SELECT 1 FROM public.todos t WHERE t.id = todo_id));
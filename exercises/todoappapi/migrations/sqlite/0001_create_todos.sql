@@ -0,0 +1,12 @@
+-- sqlite flavour of ../0001_create_todos.sql. duedate is kept as YYYY-MM-DD text,
+-- which sorts and compares the same way a postgres date does.
+CREATE TABLE
+  todos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    description TEXT NOT NULL,
+    done BOOLEAN NOT NULL,
+    duedate TEXT NULL
+  );
+
+INSERT INTO "todos" ("description", "done", "duedate", "id") VALUES ('pet dog', true, '2022-12-25', 1);
+INSERT INTO "todos" ("description", "done", "duedate", "id") VALUES ('solve a murder mystery', false, '2023-11-25', 2);
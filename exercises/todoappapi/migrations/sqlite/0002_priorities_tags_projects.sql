@@ -0,0 +1,29 @@
+-- sqlite flavour of ../0002_priorities_tags_projects.sql.
+-- AUTOINCREMENT already moves past explicitly inserted ids, so there is no sequence to fix up.
+CREATE TABLE
+  projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+  );
+
+CREATE TABLE
+  tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+  );
+
+CREATE TABLE
+  todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+  );
+
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN project_id INTEGER NULL REFERENCES projects (id) ON DELETE SET NULL;
+
+INSERT INTO "projects" ("name") VALUES ('home');
+UPDATE "todos" SET "priority" = 2, "project_id" = (SELECT "id" FROM "projects" WHERE "name" = 'home') WHERE "id" = 1;
+
+INSERT INTO "tags" ("name") VALUES ('pets');
+INSERT INTO "todo_tags" ("todo_id", "tag_id") VALUES (1, (SELECT "id" FROM "tags" WHERE "name" = 'pets'));
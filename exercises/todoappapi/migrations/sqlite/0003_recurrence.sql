@@ -0,0 +1,2 @@
+-- sqlite flavour of ../0003_recurrence.sql
+ALTER TABLE todos ADD COLUMN recurrence TEXT NULL;
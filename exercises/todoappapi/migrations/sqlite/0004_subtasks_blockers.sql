@@ -0,0 +1,12 @@
+-- sqlite flavour of ../0004_subtasks_blockers.sql
+ALTER TABLE todos ADD COLUMN parent_id INTEGER NULL REFERENCES todos (id) ON DELETE CASCADE;
+
+CREATE INDEX todos_parent_id_idx ON todos (parent_id);
+
+CREATE TABLE
+  todo_blockers (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    blocked_by_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, blocked_by_id),
+    CONSTRAINT todo_blockers_not_self CHECK (todo_id <> blocked_by_id)
+  );
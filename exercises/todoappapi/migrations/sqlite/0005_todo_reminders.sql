@@ -0,0 +1,9 @@
+-- sqlite flavour of ../0005_todo_reminders.sql
+CREATE TABLE
+  todo_reminders (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    duedate TEXT NOT NULL,
+    sent_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, kind, duedate)
+  );
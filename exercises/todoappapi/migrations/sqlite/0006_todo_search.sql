@@ -0,0 +1,23 @@
+-- sqlite flavour of ../0006_todo_search.sql. An external content fts5 table stands in
+-- for the tsvector column, and the triggers keep it in step with todos.
+CREATE VIRTUAL TABLE todos_fts USING fts5 (
+  description,
+  content = 'todos',
+  content_rowid = 'id',
+  tokenize = 'porter unicode61'
+);
+
+INSERT INTO todos_fts (rowid, description) SELECT id, description FROM todos;
+
+CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+  INSERT INTO todos_fts (rowid, description) VALUES (new.id, new.description);
+END;
+
+CREATE TRIGGER todos_fts_delete AFTER DELETE ON todos BEGIN
+  INSERT INTO todos_fts (todos_fts, rowid, description) VALUES ('delete', old.id, old.description);
+END;
+
+CREATE TRIGGER todos_fts_update AFTER UPDATE OF description ON todos BEGIN
+  INSERT INTO todos_fts (todos_fts, rowid, description) VALUES ('delete', old.id, old.description);
+  INSERT INTO todos_fts (rowid, description) VALUES (new.id, new.description);
+END;
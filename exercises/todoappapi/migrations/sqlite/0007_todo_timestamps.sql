@@ -0,0 +1,20 @@
+-- sqlite flavour of ../0007_todo_timestamps.sql. ALTER TABLE can't add a column defaulting to
+-- the current time, so an insert trigger fills created_at in. Timestamps are ISO 8601 text in UTC.
+ALTER TABLE todos ADD COLUMN created_at TEXT NULL;
+ALTER TABLE todos ADD COLUMN done_at TEXT NULL;
+
+UPDATE todos SET created_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+
+CREATE INDEX todos_done_at_idx ON todos (done_at) WHERE done_at IS NOT NULL;
+
+CREATE TRIGGER todos_timestamps_insert AFTER INSERT ON todos BEGIN
+  UPDATE todos SET
+    created_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now'),
+    done_at = CASE WHEN new.done THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') END
+  WHERE id = new.id;
+END;
+
+CREATE TRIGGER todos_timestamps_done AFTER UPDATE OF done ON todos WHEN new.done <> old.done BEGIN
+  UPDATE todos SET done_at = CASE WHEN new.done THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') END
+  WHERE id = new.id;
+END;
@@ -0,0 +1,5 @@
+-- sqlite flavour of ../0008_workspaces.sql. There is no row level security, the scoping is
+-- only in the store's queries.
+ALTER TABLE todos ADD COLUMN workspace TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX todos_workspace_idx ON todos (workspace, id);
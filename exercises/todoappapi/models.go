@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -10,20 +11,53 @@ type todo struct {
 	description string
 	done        bool
 	duedate     time.Time
+	priority    priority
+	tags        []string
+	project     string
+	recurrence  *recurrence
+	parent      int    // 0 for top level todos
+	blockedBy   []int  // ids of the todos that have to be done first
+	subtasks    []todo // only filled in by todoStore.Tree
 }
 
 // We have to satisfy the json.Marshaler interface which needs the MarshalJSON method
 func (t todo) MarshalJSON() ([]byte, error) {
+	tags, blockedBy := t.tags, t.blockedBy
+	if tags == nil {
+		tags = []string{} // an empty list reads better than null for clients
+	}
+	if blockedBy == nil {
+		blockedBy = []int{}
+	}
+	var parent *int
+	if t.parent != 0 {
+		parent = &t.parent
+	}
+
 	todoReplica := struct {
 		Id          int
 		Description string
 		Done        bool
 		Duedate     string
+		Priority    string
+		Tags        []string
+		Project     string
+		Recurrence  string
+		Parent      *int
+		BlockedBy   []int
+		Subtasks    []todo `json:",omitempty"`
 	}{
 		Id:          t.id,
 		Description: t.description,
 		Done:        t.done,
 		Duedate:     t.duedate.Format(time.RFC3339),
+		Priority:    t.priority.String(),
+		Tags:        tags,
+		Project:     t.project,
+		Recurrence:  t.recurrence.String(),
+		Parent:      parent,
+		BlockedBy:   blockedBy,
+		Subtasks:    t.subtasks,
 	}
 
 	res, err := json.Marshal(todoReplica)
@@ -32,3 +66,34 @@ func (t todo) MarshalJSON() ([]byte, error) {
 	}
 	return res, nil
 }
+
+// priority is stored as a small integer in the todos table, but clients only ever see the names
+type priority int
+
+const (
+	priorityNone priority = iota
+	priorityLow
+	priorityMedium
+	priorityHigh
+)
+
+var priorityNames = [...]string{"none", "low", "medium", "high"}
+
+func (p priority) String() string {
+	if p < priorityNone || p > priorityHigh {
+		return priorityNames[priorityNone]
+	}
+	return priorityNames[p]
+}
+
+func parsePriority(s string) (priority, error) {
+	if s == "" {
+		return priorityNone, nil
+	}
+	for i, name := range priorityNames {
+		if name == s {
+			return priority(i), nil
+		}
+	}
+	return priorityNone, fmt.Errorf("unknown priority %q, expected one of none, low, medium, high", s)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// notifier delivers a reminder somewhere a human will see it
+type notifier interface {
+	Notify(ctx context.Context, r reminder) error
+}
+
+func newNotifier(cfg config) (notifier, error) {
+	switch cfg.reminderNotifier {
+	case "log":
+		return logNotifier{}, nil
+	case "webhook":
+		if cfg.reminderWebhookURL == "" {
+			return nil, fmt.Errorf("the webhook notifier needs TODOAPP_REMINDER_WEBHOOK_URL")
+		}
+		return &webhookNotifier{url: cfg.reminderWebhookURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "smtp":
+		if cfg.reminderSMTPTo == "" {
+			return nil, fmt.Errorf("the smtp notifier needs TODOAPP_REMINDER_SMTP_TO")
+		}
+		return &smtpNotifier{addr: cfg.reminderSMTPAddr, from: cfg.reminderSMTPFrom, to: strings.Split(cfg.reminderSMTPTo, ",")}, nil
+	}
+	return nil, fmt.Errorf("unknown reminder notifier %q, expected log, webhook or smtp", cfg.reminderNotifier)
+}
+
+func reminderSubject(r reminder) string {
+	if r.kind == reminderOverdue {
+		return fmt.Sprintf("Overdue since %s: %s", r.todo.duedate.Format("2006-01-02"), r.todo.description)
+	}
+	return fmt.Sprintf("Due on %s: %s", r.todo.duedate.Format("2006-01-02"), r.todo.description)
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, r reminder) error {
+	log.Printf("reminder: todo %d: %s", r.todo.id, reminderSubject(r))
+	return nil
+}
+
+// webhookNotifier POSTs {"Kind": ..., "Todo": {...}} to url and expects a 2xx back
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, r reminder) error {
+	body, err := json.Marshal(struct {
+		Kind reminderKind
+		Todo todo
+	}{r.kind, r.todo})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with %s", res.Status)
+	}
+	return nil
+}
+
+// smtpNotifier sends a plain text mail without auth, which is what local test servers like mailpit want
+// (make mail-up starts one)
+type smtpNotifier struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (n *smtpNotifier) Notify(_ context.Context, r reminder) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", reminderSubject(r)))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nTodo #%d, priority %s.\r\n", r.todo.description, r.todo.id, r.todo.priority)
+
+	return smtp.SendMail(n.addr, nil, n.from, n.to, msg.Bytes())
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is the subset of RFC 5545 RRULEs we support:
+// FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, BYDAY (weekly only), BYMONTH (yearly only),
+// BYMONTHDAY (monthly, or yearly along with BYMONTH) and UNTIL.
+// The shorthands "daily", "weekly", "monthly" and "yearly" are accepted too.
+// Nothing in here knows about the database, the stores only call next() when a todo is marked done.
+type recurrence struct {
+	freq       string
+	interval   int
+	byDay      []time.Weekday // sorted from Monday, weekly rules only
+	byMonth    time.Month     // yearly rules only
+	byMonthDay int            // 1-31, monthly rules, or yearly ones with byMonth
+	until      time.Time
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRecurrence(s string) (*recurrence, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(s) {
+	case "daily", "weekly", "monthly", "yearly":
+		return &recurrence{freq: strings.ToUpper(s), interval: 1}, nil
+	}
+
+	rule := &recurrence{interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(s), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("recurrence part %q is not KEY=VALUE", part)
+		}
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				rule.freq = value
+			default:
+				return nil, fmt.Errorf("unsupported recurrence FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("recurrence INTERVAL %q must be a positive number", value)
+			}
+			rule.interval = n
+		case "BYDAY":
+			seen := map[time.Weekday]bool{}
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unknown recurrence BYDAY %q", day)
+				}
+				seen[wd] = true
+			}
+			for i := range 7 {
+				if wd := mondayFirst(i); seen[wd] {
+					rule.byDay = append(rule.byDay, wd)
+				}
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 31 {
+				return nil, fmt.Errorf("recurrence BYMONTHDAY %q must be between 1 and 31", value)
+			}
+			rule.byMonthDay = n
+		case "BYMONTH":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 12 {
+				return nil, fmt.Errorf("recurrence BYMONTH %q must be between 1 and 12", value)
+			}
+			rule.byMonth = time.Month(n)
+		case "UNTIL":
+			until, err := parseRRuleDate(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.until = until
+		default:
+			return nil, fmt.Errorf("unsupported recurrence part %q", key)
+		}
+	}
+
+	if rule.freq == "" {
+		return nil, fmt.Errorf("recurrence %q has no FREQ", s)
+	}
+	if len(rule.byDay) > 0 && rule.freq != "WEEKLY" {
+		return nil, fmt.Errorf("recurrence BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if rule.byMonth != 0 && rule.freq != "YEARLY" {
+		return nil, fmt.Errorf("recurrence BYMONTH is only supported with FREQ=YEARLY")
+	}
+	if rule.byMonthDay != 0 && rule.freq != "MONTHLY" && rule.byMonth == 0 {
+		return nil, fmt.Errorf("recurrence BYMONTHDAY is only supported with FREQ=MONTHLY, or FREQ=YEARLY and BYMONTH")
+	}
+	return rule, nil
+}
+
+func parseRRuleDate(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("recurrence UNTIL %q is not a YYYYMMDD date", s)
+}
+
+// String gives back the rule in RRULE form, which is also how it is stored
+func (r *recurrence) String() string {
+	if r == nil {
+		return ""
+	}
+	parts := []string{"FREQ=" + r.freq}
+	if r.interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.interval))
+	}
+	if len(r.byDay) > 0 {
+		days := make([]string, len(r.byDay))
+		for i, wd := range r.byDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.byMonth != 0 {
+		parts = append(parts, "BYMONTH="+strconv.Itoa(int(r.byMonth)))
+	}
+	if r.byMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.byMonthDay))
+	}
+	if !r.until.IsZero() {
+		parts = append(parts, "UNTIL="+r.until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// next returns the first occurrence strictly after from.
+// ok is false once the rule has run past UNTIL.
+func (r *recurrence) next(from time.Time) (next time.Time, ok bool) {
+	switch r.freq {
+	case "DAILY":
+		next = from.AddDate(0, 0, r.interval)
+	case "WEEKLY":
+		next = r.nextWeekly(from)
+	case "MONTHLY":
+		day := from.Day()
+		if r.byMonthDay != 0 {
+			day = r.byMonthDay
+			// from may be before the day in its own month, the 10th with BYMONTHDAY=15 is due on the 15th
+			if same := addMonthsClamped(from, 0, day); same.After(from) {
+				next = same
+				break
+			}
+		}
+		next = addMonthsClamped(from, r.interval, day)
+	case "YEARLY":
+		months, day := 0, from.Day()
+		if r.byMonth != 0 {
+			months = int(r.byMonth) - int(from.Month())
+			day = cmp.Or(r.byMonthDay, day)
+			// like BYMONTHDAY above, the date may still be ahead in from's own year
+			if same := addMonthsClamped(from, months, day); same.After(from) {
+				next = same
+				break
+			}
+		}
+		next = addMonthsClamped(from, months+12*r.interval, day)
+	}
+
+	if !r.until.IsZero() && next.After(endOfDay(r.until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// nextWeekly walks to the next BYDAY in the current week, or jumps interval weeks ahead
+// and starts over from the first BYDAY of that week. Weeks start on Monday, the RRULE default
+// for WKST, so Sunday is the end of a week and not the start of the next one.
+func (r *recurrence) nextWeekly(from time.Time) time.Time {
+	if len(r.byDay) == 0 {
+		return from.AddDate(0, 0, 7*r.interval)
+	}
+	today := weekdayIndex(from.Weekday())
+	for _, wd := range r.byDay {
+		if i := weekdayIndex(wd); i > today {
+			return from.AddDate(0, 0, i-today)
+		}
+	}
+	weekStart := from.AddDate(0, 0, -today)
+	return weekStart.AddDate(0, 0, 7*r.interval+weekdayIndex(r.byDay[0]))
+}
+
+// weekdayIndex counts days from Monday, Monday is 0 and Sunday 6
+func weekdayIndex(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+// mondayFirst is the weekday with index i
+func mondayFirst(i int) time.Weekday {
+	return time.Weekday((i + 1) % 7)
+}
+
+// addMonthsClamped moves months ahead and lands on day, or on the last day of the month
+// when it is shorter (a monthly todo due on the 31st is due on the 30th in April, not May 1st).
+// The day has to come from the rule, see anchored: from.Day() of a clamped date stays clamped.
+func addMonthsClamped(from time.Time, months, day int) time.Time {
+	first := time.Date(from.Year(), from.Month(), 1, from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), from.Location())
+	first = first.AddDate(0, months, 0)
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// anchored pins a monthly rule to the day of from and a yearly one to its month and day, unless
+// the rule says already. Otherwise a todo due on the 31st would go to the 28th in February and
+// then stay on the 28th, every occurrence only knows the date of the one before.
+func (r *recurrence) anchored(from time.Time) *recurrence {
+	a := *r
+	switch {
+	case r.freq == "MONTHLY" && r.byMonthDay == 0:
+		a.byMonthDay = from.Day()
+	case r.freq == "YEARLY" && r.byMonth == 0:
+		a.byMonth, a.byMonthDay = from.Month(), from.Day()
+	default:
+		return r
+	}
+	return &a
+}
+
+func endOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, t.Location())
+}
+
+// nextOccurrence is the todo that replaces t once t is marked done, if t recurs at all.
+// A recurring todo without a duedate counts from today. The next occurrence stays under
+// the same parent but starts out unblocked.
+func (t todo) nextOccurrence(today time.Time) (todo, bool) {
+	if t.recurrence == nil {
+		return todo{}, false
+	}
+	from := t.duedate
+	if from.IsZero() {
+		from = today
+	}
+	rule := t.recurrence.anchored(from)
+	due, ok := rule.next(from)
+	if !ok {
+		return todo{}, false
+	}
+
+	next := t
+	next.recurrence = rule
+	next.id = 0
+	next.done = false
+	next.duedate = due
+	next.tags = append([]string(nil), t.tags...)
+	next.blockedBy = nil // whatever blocked this occurrence has nothing to do with the next one
+	next.subtasks = nil
+	return next, true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	// 2026-01-05 is a Monday
+	tests := []struct {
+		rule string
+		from string
+		want string // empty when the rule has run out
+	}{
+		{"daily", "2026-01-10", "2026-01-11"},
+		{"FREQ=DAILY;INTERVAL=3", "2026-01-10", "2026-01-13"},
+		{"FREQ=DAILY;UNTIL=20260111", "2026-01-10", "2026-01-11"},
+		{"FREQ=DAILY;UNTIL=20260111", "2026-01-11", ""},
+
+		{"weekly", "2026-01-07", "2026-01-14"},
+		{"FREQ=WEEKLY;INTERVAL=2", "2026-01-07", "2026-01-21"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-01-07", "2026-01-09"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-01-09", "2026-01-12"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR", "2026-01-11", "2026-01-12"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE,FR;INTERVAL=2", "2026-01-09", "2026-01-19"},
+		// weeks start on Monday, so Sunday comes after Monday in the same week
+		{"FREQ=WEEKLY;BYDAY=SU,MO;INTERVAL=2", "2026-01-05", "2026-01-11"},
+		{"FREQ=WEEKLY;BYDAY=SU,MO;INTERVAL=2", "2026-01-11", "2026-01-19"},
+
+		{"monthly", "2026-01-10", "2026-02-10"},
+		{"monthly", "2026-01-31", "2026-02-28"},
+		{"FREQ=MONTHLY;INTERVAL=3", "2026-01-15", "2026-04-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", "2026-01-10", "2026-01-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", "2026-01-15", "2026-02-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", "2026-01-20", "2026-02-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=15;INTERVAL=2", "2026-01-20", "2026-03-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2026-01-31", "2026-02-28"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2026-02-28", "2026-03-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2028-01-31", "2028-02-29"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2026-04-30", "2026-05-31"},
+
+		{"yearly", "2026-03-01", "2027-03-01"},
+		{"yearly", "2028-02-29", "2029-02-28"},
+		{"FREQ=YEARLY;INTERVAL=2", "2026-03-01", "2028-03-01"},
+		{"FREQ=YEARLY;UNTIL=20270101", "2026-03-01", ""},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "2029-02-28", "2030-02-28"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "2031-02-28", "2032-02-29"},
+		{"FREQ=YEARLY;BYMONTH=6", "2026-03-10", "2026-06-10"},
+	}
+	for _, tt := range tests {
+		rule, err := parseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatalf("parseRecurrence(%q): %v", tt.rule, err)
+		}
+		from, _ := time.Parse(time.DateOnly, tt.from)
+		next, ok := rule.next(from)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%s from %s: got %s, want no next occurrence", tt.rule, tt.from, next.Format(time.DateOnly))
+		case tt.want != "" && !ok:
+			t.Errorf("%s from %s: got no next occurrence, want %s", tt.rule, tt.from, tt.want)
+		case tt.want != "" && next.Format(time.DateOnly) != tt.want:
+			t.Errorf("%s from %s: got %s, want %s", tt.rule, tt.from, next.Format(time.DateOnly), tt.want)
+		}
+	}
+}
+
+func TestRecurrenceNextKeepsTimeOfDay(t *testing.T) {
+	rule, _ := parseRecurrence("FREQ=MONTHLY;BYMONTHDAY=10")
+	from := time.Date(2026, 1, 10, 9, 30, 0, 0, time.UTC)
+	want := time.Date(2026, 2, 10, 9, 30, 0, 0, time.UTC)
+	if next, _ := rule.next(from); !next.Equal(want) {
+		t.Errorf("got %s, want %s", next, want)
+	}
+}
+
+// A chain of occurrences has to keep to the day of the first one, not the clamped day of the last
+func TestNextOccurrenceKeepsTheDay(t *testing.T) {
+	tests := []struct {
+		rule  string
+		first string
+		want  []string
+	}{
+		{"monthly", "2026-01-31", []string{"2026-02-28", "2026-03-31", "2026-04-30", "2026-05-31"}},
+		{"FREQ=MONTHLY;INTERVAL=2", "2025-12-31", []string{"2026-02-28", "2026-04-30", "2026-06-30", "2026-08-31"}},
+		{"yearly", "2024-02-29", []string{"2025-02-28", "2026-02-28", "2027-02-28", "2028-02-29"}},
+	}
+	for _, tt := range tests {
+		rule, err := parseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		due, _ := time.Parse(time.DateOnly, tt.first)
+		current := todo{description: tt.rule, duedate: due, recurrence: rule}
+		for _, want := range tt.want {
+			next, ok := current.nextOccurrence(time.Now())
+			if !ok || next.duedate.Format(time.DateOnly) != want {
+				t.Errorf("%s from %s: got %s, want %s", tt.rule, tt.first, next.duedate.Format(time.DateOnly), want)
+				break
+			}
+			current = next
+		}
+	}
+	// the todo the chain started from keeps its rule as it was
+	rule, _ := parseRecurrence("monthly")
+	first := todo{duedate: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC), recurrence: rule}
+	if next, _ := first.nextOccurrence(time.Now()); rule.String() != "FREQ=MONTHLY" || next.recurrence.String() != "FREQ=MONTHLY;BYMONTHDAY=31" {
+		t.Errorf("rules after nextOccurrence: %s and %s", rule, next.recurrence)
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"weekly", "FREQ=WEEKLY"},
+		{"RRULE:FREQ=WEEKLY;BYDAY=su,mo,fr", "FREQ=WEEKLY;BYDAY=MO,FR,SU"},
+		{"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31"},
+		{"FREQ=DAILY;UNTIL=20261231T000000Z", "FREQ=DAILY;UNTIL=20261231"},
+		{"FREQ=YEARLY;BYMONTHDAY=29;BYMONTH=2", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29"},
+	}
+	for _, tt := range tests {
+		rule, err := parseRecurrence(tt.in)
+		if err != nil {
+			t.Fatalf("parseRecurrence(%q): %v", tt.in, err)
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("parseRecurrence(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"hourly",
+		"INTERVAL=2",
+		"FREQ=WEEKLY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYMONTHDAY=3",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTHDAY=29",
+		"FREQ=MONTHLY;BYMONTH=2",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;COUNT=3",
+	} {
+		if _, err := parseRecurrence(in); err == nil {
+			t.Errorf("parseRecurrence(%q) accepted an invalid rule", in)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+)
+
+// PUT /todos/{id}/parent/{parent} makes {id} a subtask of {parent}
+func setParent(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
+	parent, ok := routeID(rw, r, "parent")
+	if !ok {
+		return
+	}
+	updateRelation(rw, r, id, store.SetParent(r.Context(), id, parent))
+}
+
+// DELETE /todos/{id}/parent turns a subtask back into a top level todo
+func clearParent(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
+	updateRelation(rw, r, id, store.SetParent(r.Context(), id, 0))
+}
+
+// PUT /todos/{id}/blockers/{blocker} means {id} cannot be done before {blocker} is
+func addBlocker(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
+	blocker, ok := routeID(rw, r, "blocker")
+	if !ok {
+		return
+	}
+	updateRelation(rw, r, id, store.AddBlocker(r.Context(), id, blocker))
+}
+
+// DELETE /todos/{id}/blockers/{blocker}
+func removeBlocker(rw http.ResponseWriter, r *http.Request) {
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
+	blocker, ok := routeID(rw, r, "blocker")
+	if !ok {
+		return
+	}
+	updateRelation(rw, r, id, store.RemoveBlocker(r.Context(), id, blocker))
+}
+
+// updateRelation answers a relation change with the todo as it looks afterwards
+func updateRelation(rw http.ResponseWriter, r *http.Request, id int, err error) {
+	if err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+	t, err := store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, t)
+}
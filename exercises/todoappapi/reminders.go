@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type reminderKind string
+
+const (
+	reminderUpcoming reminderKind = "upcoming" // due within the configured lead time
+	reminderOverdue  reminderKind = "overdue"  // duedate is in the past and the todo is still open
+)
+
+type reminder struct {
+	todo todo
+	kind reminderKind
+}
+
+// reminderStore is the part of the storage layer the scheduler needs.
+// Claims are stored, which is what keeps a restart from sending the same reminder twice.
+type reminderStore interface {
+	// PendingReminders returns open todos due on or before horizon that have not been
+	// reminded about yet for the kind of reminder that applies to them today
+	PendingReminders(ctx context.Context, today, horizon time.Time) ([]reminder, error)
+	// ClaimReminder records r as sent. It returns false if somebody else got there first.
+	ClaimReminder(ctx context.Context, r reminder) (bool, error)
+	// ReleaseReminder forgets a claim so the reminder is retried on the next tick
+	ReleaseReminder(ctx context.Context, r reminder) error
+}
+
+// reminderKindFor works out which reminder a todo due on duedate gets on today
+func reminderKindFor(duedate, today time.Time) reminderKind {
+	if duedate.Before(today) {
+		return reminderOverdue
+	}
+	return reminderUpcoming
+}
+
+type reminderScheduler struct {
+	store    reminderStore
+	notifier notifier
+	interval time.Duration
+	lead     time.Duration
+	now      func() time.Time
+	tracer   *tracer
+}
+
+func newReminderScheduler(store reminderStore, n notifier, interval, lead time.Duration, tracer *tracer) *reminderScheduler {
+	return &reminderScheduler{store: store, notifier: n, interval: interval, lead: lead, now: time.Now, tracer: tracer}
+}
+
+// run checks for due todos every interval until ctx is cancelled
+func (s *reminderScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		// every tick is a trace of its own, its log lines carry the trace id
+		tickCtx, sp := s.tracer.start(ctx, "reminders.tick")
+		err := s.tick(tickCtx)
+		if err != nil {
+			slog.ErrorContext(tickCtx, "reminders: checking for due todos", "err", err)
+		}
+		sp.finish(err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick sends every reminder that is due right now. A reminder is claimed before it is sent
+// and released again if sending fails, so it goes out at most once and is retried on failure.
+func (s *reminderScheduler) tick(ctx context.Context) error {
+	now := s.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // duedate is a plain date
+	horizon := today.Add(s.lead)
+
+	pending, err := s.store.PendingReminders(ctx, today, horizon)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range pending {
+		claimed, err := s.store.ClaimReminder(ctx, r)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.notifier.Notify(ctx, r); err != nil {
+			slog.ErrorContext(ctx, "reminders: notifying", "todo.id", r.todo.id, "err", err)
+			if err := s.store.ReleaseReminder(ctx, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps what it was asked to send, failing the first attempt for the todos in fail
+type recordingNotifier struct {
+	sent map[string]int // "<todo id> <kind>"
+	fail map[int]bool
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, r reminder) error {
+	if n.fail[r.todo.id] {
+		delete(n.fail, r.todo.id)
+		return errors.New("the mail server is down")
+	}
+	n.sent[fmt.Sprintf("%d %s", r.todo.id, r.kind)]++
+	return nil
+}
+
+func TestRemindersGoOutOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := context.Background()
+		day := func(d string) time.Time {
+			t, _ := time.Parse(time.DateOnly, d)
+			return t
+		}
+		overdue := mustCreate(t, ctx, s, todo{description: "overdue", duedate: day("2026-10-19")})
+		upcoming := mustCreate(t, ctx, s, todo{description: "due tomorrow", duedate: day("2026-10-22")})
+		flaky := mustCreate(t, ctx, s, todo{description: "first try fails", duedate: day("2026-10-20")})
+		later := mustCreate(t, ctx, s, todo{description: "due next month", duedate: day("2026-11-30")})
+		done := mustCreate(t, ctx, s, todo{description: "done already", duedate: day("2026-10-19"), done: true})
+
+		n := &recordingNotifier{sent: map[string]int{}, fail: map[int]bool{flaky.id: true}}
+		now := time.Date(2026, 10, 21, 9, 0, 0, 0, time.UTC)
+		tick := func() {
+			t.Helper()
+			// a new scheduler every time, like after a restart, only the store remembers
+			sched := newReminderScheduler(s.(reminderStore), n, time.Minute, 24*time.Hour, newTracer(discardExporter{}))
+			sched.now = func() time.Time { return now }
+			if err := sched.tick(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tick()
+		if n.sent[fmt.Sprintf("%d overdue", flaky.id)] != 0 {
+			t.Fatal("the reminder that failed counts as sent")
+		}
+		tick()
+		tick()
+		now = now.AddDate(0, 0, 2) // the todo due tomorrow is overdue now
+		tick()
+		tick()
+
+		want := map[string]bool{
+			fmt.Sprintf("%d overdue", overdue.id):   true,
+			fmt.Sprintf("%d upcoming", upcoming.id): true,
+			fmt.Sprintf("%d overdue", upcoming.id):  true,
+			fmt.Sprintf("%d overdue", flaky.id):     true,
+		}
+		for key, count := range n.sent {
+			if count != 1 {
+				t.Errorf("%s went out %d times", key, count)
+			}
+		}
+		for key := range want {
+			if n.sent[key] == 0 {
+				t.Errorf("%s never went out", key)
+			}
+		}
+		for _, id := range []int{later.id, done.id} {
+			for _, kind := range []reminderKind{reminderUpcoming, reminderOverdue} {
+				if key := fmt.Sprintf("%d %s", id, kind); n.sent[key] > 0 {
+					t.Errorf("%s went out", key)
+				}
+			}
+		}
+	})
+}
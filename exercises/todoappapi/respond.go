@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// apiError is the envelope every failed request gets back, so clients can switch on Code
+// instead of parsing messages
+type apiError struct {
+	Code    string
+	Message string
+}
+
+type errorResponse struct {
+	Error apiError
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	ctx, tracer, traced := requestSpan(rw)
+	var sp *span
+	if traced {
+		_, sp = tracer.start(ctx, "encode json")
+	}
+	contentType := "application/json"
+	if versionFromContext(ctx) == apiV2 {
+		v, contentType = v2Body(ctx, v), mediaTypeV2
+	}
+	res, err := json.Marshal(v)
+	if sp != nil {
+		sp.setAttr("bytes", len(res))
+		sp.finish(err)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding response", "err", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(status)
+	fmt.Fprintln(rw, string(res))
+}
+
+func writeError(rw http.ResponseWriter, status int, code, message string) {
+	writeJSON(rw, status, errorResponse{apiError{Code: code, Message: message}})
+}
+
+// writeInternalError logs the real cause and only tells the client that something went wrong
+func writeInternalError(rw http.ResponseWriter, err error) {
+	slog.ErrorContext(requestContext(rw), "internal error", "err", err)
+	writeError(rw, http.StatusInternalServerError, "internal", "something went wrong on our end")
+}
+
+// writeBodyError answers a validationError with a 422 that lists every bad field, a body over
+// the route's limit with a 413 and anything else decodeBody returns with a 400
+func writeBodyError(rw http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(rw, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("the body can be at most %d bytes", tooLarge.Limit))
+		return
+	}
+	var invalid validationError
+	if !errors.As(err, &invalid) {
+		writeError(rw, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+	invalid = invalid.forVersion(versionFromContext(requestContext(rw)))
+	writeJSON(rw, http.StatusUnprocessableEntity, validationErrorResponse{
+		Error:  apiError{Code: "validation_failed", Message: invalid.Error()},
+		Fields: invalid,
+	})
+}
+
+type validationErrorResponse struct {
+	Error  apiError
+	Fields []fieldError
+}
+
+// writeStoreError answers with the status that matches one of the todoStore errors,
+// and falls back to a 500 for anything else
+func writeStoreError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotFound):
+		writeError(rw, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, errUnknownReference):
+		writeError(rw, http.StatusBadRequest, "unknown_reference", err.Error())
+	case errors.Is(err, errCycle):
+		writeError(rw, http.StatusConflict, "cycle", err.Error())
+	case errors.Is(err, errOpenSubtasks):
+		writeError(rw, http.StatusConflict, "open_subtasks", err.Error())
+	case errors.Is(err, errBlocked):
+		writeError(rw, http.StatusConflict, "blocked", err.Error())
+	case errors.Is(err, errHasSubtasks):
+		writeError(rw, http.StatusConflict, "has_subtasks", err.Error())
+	case errors.Is(err, errNotEmpty):
+		writeError(rw, http.StatusConflict, "not_empty", err.Error())
+	case errors.Is(err, errIDTaken):
+		writeError(rw, http.StatusConflict, "id_taken", err.Error())
+	default:
+		writeInternalError(rw, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// column is one entry in the select list of a query and where its value is scanned to
+type column[R any] struct {
+	field  string // the todo field it fills
+	column string // the todos column it reads, empty for values that only come from other tables
+	expr   string
+	dest   func(r *R) any
+}
+
+// rowMapping is the select list and the Scan destinations of a query in one place, so
+// the two are always in the same order. R is the row the way the database hands it back,
+// before it is turned into a model.
+type rowMapping[R any] []column[R]
+
+func (m rowMapping[R]) selectList() string {
+	exprs := make([]string, len(m))
+	for i, c := range m {
+		exprs[i] = c.expr
+	}
+	return strings.Join(exprs, ",\n\t")
+}
+
+func (m rowMapping[R]) scan(row scanner) (R, error) {
+	var r R
+	dests := make([]any, len(m))
+	for i, c := range m {
+		dests[i] = c.dest(&r)
+	}
+	err := row.Scan(dests...)
+	return r, err
+}
+
+// columns is every todos column the mapping reads
+func (m rowMapping[R]) columns() []string {
+	var names []string
+	for _, c := range m {
+		if c.column != "" {
+			names = append(names, c.column)
+		}
+	}
+	return names
+}
+
+// fields is every todo field the mapping fills
+func (m rowMapping[R]) fields() []string {
+	names := make([]string, len(m))
+	for i, c := range m {
+		names[i] = c.field
+	}
+	return names
+}
+
+// checkSchema compares the columns the todos table has, listed by tableColumns, with what
+// the store reads. A column the store needs and the table lacks fails startup, instead of every
+// request that touches a todo. Columns the store doesn't know about are only logged: they are
+// harmless to explicit column lists and show up while a migration is ahead of the code.
+// unmapped lists columns the stores use without them being part of the model, like search.
+func checkSchema(ctx context.Context, db *sql.DB, tableColumns string, mapped []string, unmapped ...string) error {
+	missing, extra, err := schemaDiff(ctx, db, tableColumns, mapped, unmapped)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("todos table has no %s column, is the schema migrated?", strings.Join(missing, ", "))
+	}
+	for _, name := range extra {
+		slog.Warn("todos column is not mapped to the todo model", "column", name)
+	}
+	return nil
+}
+
+// schemaDiff is checkSchema's comparison: the mapped columns the table lacks, and the columns
+// it has that are neither mapped nor unmapped
+func schemaDiff(ctx context.Context, db *sql.DB, tableColumns string, mapped, unmapped []string) (missing, extra []string, err error) {
+	rows, err := db.QueryContext(ctx, tableColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var have []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, err
+		}
+		have = append(have, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range mapped {
+		if !slices.Contains(have, name) {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range have {
+		if !slices.Contains(mapped, name) && !slices.Contains(unmapped, name) {
+			extra = append(extra, name)
+		}
+	}
+	return missing, extra, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// searchResult is one hit for GET /todos/search. Snippet is the description with the
+// matching words wrapped in <mark></mark>.
+type searchResult struct {
+	Todo    todo
+	Rank    float64
+	Snippet string
+}
+
+// GET /todos/search?q=murder+mystery&limit=10 returns the best matches first
+func search(rw http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(rw, http.StatusBadRequest, "invalid_query", "the q query param is required")
+		return
+	}
+
+	limit := 20
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 100 {
+			writeError(rw, http.StatusBadRequest, "invalid_query", "limit has to be a number between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	results, err := store.Search(r.Context(), q, limit)
+	if err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+	if results == nil {
+		results = []searchResult{}
+	}
+	writeJSON(rw, http.StatusOK, results)
+}
+
+// searchTokens lowercases s and splits it into words, dropping punctuation
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tokenMatches is the fallback for stores without real full text search:
+// a query token matches a word that starts with it, so "murd" finds "murder"
+func tokenMatches(word, token string) bool {
+	return strings.HasPrefix(word, token)
+}
+
+// matchTokens scores text against the query tokens. ok is false unless every token matches
+// some word, rank is the share of words in text that matched anything.
+func matchTokens(text string, tokens []string) (rank float64, snippet string, ok bool) {
+	words := searchTokens(text)
+	if len(words) == 0 || len(tokens) == 0 {
+		return 0, "", false
+	}
+
+	for _, token := range tokens {
+		found := false
+		for _, w := range words {
+			if tokenMatches(w, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, "", false
+		}
+	}
+
+	matched := 0
+	for _, w := range words {
+		for _, token := range tokens {
+			if tokenMatches(w, token) {
+				matched++
+				break
+			}
+		}
+	}
+	return float64(matched) / float64(len(words)), highlightTokens(text, tokens), true
+}
+
+// highlightTokens wraps every word of text that matches one of tokens in <mark></mark>,
+// leaving everything else, punctuation and case included, untouched
+func highlightTokens(text string, tokens []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		word := string(runes[i:j])
+
+		hit := false
+		for _, token := range tokens {
+			if tokenMatches(strings.ToLower(word), token) {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			b.WriteString(highlightStart + word + highlightStop)
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// matchTokens is how the memory store searches, without postgres or sqlite's full text search
+func TestMatchTokens(t *testing.T) {
+	tests := []struct {
+		text, query string
+		rank        float64
+		snippet     string
+		ok          bool
+	}{
+		{"Read a murder mystery", "murd", 0.25, "Read a <mark>murder</mark> mystery", true},
+		{"Read a murder mystery", "MYSTERY murder", 0.5, "Read a <mark>murder</mark> <mark>mystery</mark>", true},
+		{"Mystery, mystery!", "myst", 1, "<mark>Mystery</mark>, <mark>mystery</mark>!", true},
+		{"Read a murder mystery", "murder novel", 0, "", false},
+		{"Read a murder mystery", "ystery", 0, "", false},
+		{"Read a murder mystery", "!!", 0, "", false},
+	}
+	for _, tt := range tests {
+		rank, snippet, ok := matchTokens(tt.text, searchTokens(tt.query))
+		if rank != tt.rank || snippet != tt.snippet || ok != tt.ok {
+			t.Errorf("matchTokens(%q, %q) = %v, %q, %v, want %v, %q, %v", tt.text, tt.query, rank, snippet, ok, tt.rank, tt.snippet, tt.ok)
+		}
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	for _, d := range []string{"buy a mystery novel", "mystery mystery shelf", "water the plants"} {
+		res, err := http.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"Description": "`+d+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	search := func(query string) (int, []struct{ Rank float64 }) {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/todos/search?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var results []struct{ Rank float64 }
+		json.NewDecoder(res.Body).Decode(&results)
+		return res.StatusCode, results
+	}
+	for _, query := range []string{"", "q=", "q=+++", "q=mystery&limit=0", "q=mystery&limit=101", "q=mystery&limit=ten"} {
+		if status, _ := search(query); status != http.StatusBadRequest {
+			t.Errorf("GET /todos/search?%s: %d, want 400", query, status)
+		}
+	}
+	status, results := search("q=mystery&limit=1")
+	if status != http.StatusOK || len(results) != 1 || results[0].Rank <= 0 {
+		t.Errorf("GET /todos/search?q=mystery&limit=1: %d %+v", status, results)
+	}
+	if status, results := search("q=lawnmower"); status != http.StatusOK || results == nil || len(results) != 0 {
+		t.Errorf("GET /todos/search?q=lawnmower: %d %+v, want an empty list", status, results)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// `go run . seed` fills the configured store with made up todos for demos and load tests.
+// The same -seed always makes the same todos. Duedates are spread around -from, which is today
+// unless set, so pass it too when the output has to be identical from one day to the next.
+//
+//	go run . seed -n 1000 -seed 7 -done 0.4 -spread 60
+//	go run . seed -n 50 -json > fixtures.json   # a file for POST /todos/import instead
+func seed(cfg config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	n := flags.Int("n", 100, "how many todos to make")
+	seedValue := flags.Uint64("seed", 1, "seed for the random generator, the same seed makes the same todos")
+	doneRatio := flags.Float64("done", 0.3, "share of todos that are already done, 0 to 1")
+	spread := flags.Int("spread", 30, "duedates fall up to this many days before or after -from")
+	from := flags.String("from", time.Now().Format(time.DateOnly), "the day duedates are spread around, YYYY-MM-DD")
+	asJSON := flags.Bool("json", false, "print the todos as a json import file instead of storing them")
+	workspace := flags.String("workspace", defaultWorkspace, "workspace to put the todos in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *n < 1:
+		return errors.New("seed: -n has to be at least 1")
+	case *doneRatio < 0 || *doneRatio > 1:
+		return errors.New("seed: -done has to be between 0 and 1")
+	case *spread < 0:
+		return errors.New("seed: -spread can't be negative")
+	case !workspaceName.MatchString(*workspace):
+		return fmt.Errorf("seed: -workspace: %w", errInvalidWorkspace)
+	}
+	day, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		return fmt.Errorf("seed: -from: %w", err)
+	}
+
+	records := newSeeder(*seedValue, *doneRatio, *spread, day).todos(*n)
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	if cfg.store == "memory" {
+		return errors.New("seed: the memory store forgets everything on exit, use -json and POST /todos/import instead")
+	}
+	todos := make([]todo, len(records))
+	for i, rec := range records {
+		in := todoInput{
+			Description: rec.Description,
+			Done:        rec.Done,
+			Duedate:     rec.Duedate,
+			Priority:    rec.Priority,
+			Tags:        rec.Tags,
+			Project:     rec.Project,
+			Recurrence:  rec.Recurrence,
+		}
+		if todos[i], err = in.toTodo(); err != nil {
+			return fmt.Errorf("seed: generated an invalid todo %+v: %w", rec, err) // a bug in the word lists
+		}
+	}
+
+	// one transaction per batch keeps a big seed from holding a single huge transaction open
+	s := openStore(cfg)
+	ctx := withWorkspace(context.Background(), *workspace)
+	const batch = 500
+	for start := 0; start < len(todos); start += batch {
+		if _, err := s.Import(ctx, todos[start:min(start+batch, len(todos))]); err != nil {
+			return fmt.Errorf("seed: %w", err)
+		}
+	}
+	log.Printf("seeded %d todos into workspace %s of the %s store (seed %d)", len(todos), *workspace, cfg.store, *seedValue)
+	return nil
+}
+
+// seedProject is what todos in one project are about. The project with no name is for
+// todos without one.
+type seedProject struct {
+	name  string
+	tasks []string
+	tags  []string
+}
+
+var seedProjects = []seedProject{
+	{"", []string{
+		"pet dog", "solve a murder mystery", "call mum", "read a chapter of the book club book",
+		"book a dentist appointment", "renew passport", "back up the laptop", "return library books",
+		"cancel the unused gym membership", "answer the wedding invitation",
+	}, []string{"personal", "phone", "online"}},
+	{"home", []string{
+		"fix the leaking kitchen tap", "clean the gutters", "replace the hallway light bulb",
+		"defrost the freezer", "vacuum the stairs", "sort the recycling", "descale the kettle",
+		"paint the spare room", "bleed the radiators", "wash the windows",
+	}, []string{"chores", "diy", "weekend"}},
+	{"work", []string{
+		"review the pull request for the billing service", "write the quarterly report",
+		"prepare slides for the all hands", "update the on-call runbook", "answer the recruiter emails",
+		"plan the sprint", "fix the flaky integration test", "upgrade the postgres driver",
+		"write up the incident postmortem", "set up the new laptop",
+	}, []string{"meeting", "email", "urgent", "review"}},
+	{"errands", []string{
+		"buy groceries", "pick up the dry cleaning", "post the birthday card", "get the car washed",
+		"collect the parcel from the depot", "top up the bus pass", "buy a present for the neighbours",
+		"drop off the old clothes at the charity shop",
+	}, []string{"shopping", "car", "town"}},
+	{"garden", []string{
+		"mow the lawn", "water the tomatoes", "prune the roses", "rake the leaves", "plant the bulbs",
+		"repair the fence panel", "empty the compost bin",
+	}, []string{"outside", "weekend", "seasonal"}},
+}
+
+var (
+	seedPriorities  = []string{"none", "none", "none", "none", "low", "low", "medium", "medium", "high"}
+	seedRecurrences = []string{"daily", "weekly", "weekly", "monthly", "FREQ=WEEKLY;BYDAY=MO", "yearly"}
+)
+
+// seeder makes todos from a fixed seed, every draw goes through rnd so the order of the
+// draws is part of what the seed reproduces
+type seeder struct {
+	rnd       *rand.Rand
+	doneRatio float64
+	spread    int
+	from      time.Time
+}
+
+func newSeeder(seed uint64, doneRatio float64, spread int, from time.Time) *seeder {
+	return &seeder{rnd: rand.New(rand.NewPCG(seed, seed)), doneRatio: doneRatio, spread: spread, from: from}
+}
+
+func (s *seeder) todos(n int) []jsonImportRecord {
+	records := make([]jsonImportRecord, n)
+	for i := range records {
+		records[i] = s.todo()
+	}
+	return records
+}
+
+func (s *seeder) todo() jsonImportRecord {
+	p := seedProjects[s.rnd.IntN(len(seedProjects))]
+	rec := jsonImportRecord{
+		Description: p.tasks[s.rnd.IntN(len(p.tasks))],
+		Done:        s.rnd.Float64() < s.doneRatio,
+		Priority:    seedPriorities[s.rnd.IntN(len(seedPriorities))],
+		Project:     p.name,
+	}
+
+	// one in four todos has no duedate, like in real lists
+	if s.rnd.IntN(4) > 0 {
+		offset := s.rnd.IntN(2*s.spread+1) - s.spread
+		rec.Duedate = s.from.AddDate(0, 0, offset).Format(time.DateOnly)
+	}
+	// up to two tags, sorted the way the stores hand them back
+	for _, i := range s.rnd.Perm(len(p.tags))[:s.rnd.IntN(3)] {
+		rec.Tags = append(rec.Tags, p.tags[i])
+	}
+	slices.Sort(rec.Tags)
+	if !rec.Done && rec.Duedate != "" && s.rnd.IntN(10) == 0 {
+		rec.Recurrence = seedRecurrences[s.rnd.IntN(len(seedRecurrences))]
+	}
+	return rec
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSeedIsDeterministic(t *testing.T) {
+	run := func(args ...string) []byte {
+		t.Helper()
+		var out bytes.Buffer
+		if err := seed(testConfig(), append([]string{"-json", "-n", "200", "-from", "2026-10-19"}, args...), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+
+	first := run("-seed", "7")
+	if again := run("-seed", "7"); !bytes.Equal(first, again) {
+		t.Errorf("-seed 7 made different todos the second time:\n%s\nvs\n%s", first, again)
+	}
+	if other := run("-seed", "8"); bytes.Equal(first, other) {
+		t.Error("-seed 7 and -seed 8 made the same todos")
+	}
+	if later := run("-seed", "7", "-from", "2026-10-20"); bytes.Equal(first, later) {
+		t.Error("-from doesn't move the duedates")
+	}
+
+	// and what it makes is a valid import file
+	lines, err := parseJSONImport(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 200 {
+		t.Fatalf("got %d todos, want 200", len(lines))
+	}
+	for _, l := range lines {
+		if l.err != nil {
+			t.Fatalf("todo %d: %v", l.line, l.err)
+		}
+		if _, err := l.in.toTodo(); err != nil {
+			t.Fatalf("todo %d: %v", l.line, err)
+		}
+	}
+}
@@ -1,41 +1,54 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
+// GET /todos/{id}?nested=true also returns every subtask, nested under its parent
 func show(rw http.ResponseWriter, r *http.Request) {
-	rw.Header().Set("Content-Type", "application/json")
-
-	id := mux.Vars(r)["id"]
-	var todo todo
-	query := `SELECT * FROM todos WHERE id = $1`
+	id, ok := todoID(rw, r)
+	if !ok {
+		return
+	}
 
-	stmt, err := db.Prepare(query)
+	var (
+		todo todo
+		err  error
+	)
+	if nested, _ := strconv.ParseBool(r.URL.Query().Get("nested")); nested {
+		todo, err = store.Tree(r.Context(), id)
+	} else {
+		todo, err = store.Get(r.Context(), id)
+	}
+	if errors.Is(err, errNotFound) && versionFromContext(r.Context()) == apiV1 {
+		writeJSON(rw, http.StatusOK, struct{}{}) // unknown ids have always been an empty object
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		writeStoreError(rw, err) // v2 answers unknown ids with a 404 like every other endpoint
+		return
 	}
-	defer stmt.Close()
 
-	row := stmt.QueryRow(id)
-	if err := row.Scan(&todo.id, &todo.description, &todo.done, &todo.duedate); err != nil {
-		if err == sql.ErrNoRows {
-			fmt.Fprintln(rw, "{}")
-			return
-		} else {
-			log.Fatal(err)
-		}
-	}
+	writeJSON(rw, http.StatusOK, todo)
+}
+
+// todoID pulls the {id} route variable out of the request and answers with a 400 if it is not a number
+func todoID(rw http.ResponseWriter, r *http.Request) (int, bool) {
+	return routeID(rw, r, "id")
+}
 
-	res, err := json.Marshal(todo)
+// routeID is todoID for any route variable that holds a todo id
+func routeID(rw http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	raw := mux.Vars(r)[name]
+	id, err := strconv.Atoi(raw)
 	if err != nil {
-		log.Fatal(err)
+		writeError(rw, http.StatusBadRequest, "invalid_id", fmt.Sprintf("todo id %q is not a number", raw))
+		return 0, false
 	}
-	fmt.Fprintln(rw, string(res))
+	return id, true
 }
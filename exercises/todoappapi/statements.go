@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// statementMetrics shows up under todo_statements in GET /debug/vars
+var statementMetrics = expvar.NewMap("todo_statements")
+
+// stmtRegistry hands out prepared statements by query text. Every query the stores run is
+// parsed and planned once, when it is first seen or at startup for the ones passed to
+// newStmtRegistry, and then reused for as long as the process runs. database/sql takes care
+// of preparing a statement again on connections that haven't seen it yet.
+//
+// Queries that are put together at runtime, List with its filters, end up with one statement
+// per shape. Only which filters are set changes the text, values always go in as parameters
+// (a list of tags as a single one), so that stays a small number.
+type stmtRegistry struct {
+	db *sql.DB
+
+	mu        sync.RWMutex
+	stmts     map[string]*sql.Stmt
+	queued    map[string]bool // waiting to be prepared in the background
+	preparing bool            // the background goroutine is running
+}
+
+func newStmtRegistry(ctx context.Context, db *sql.DB, queries ...string) (*stmtRegistry, error) {
+	r := &stmtRegistry{db: db, stmts: map[string]*sql.Stmt{}, queued: map[string]bool{}}
+	for _, q := range queries {
+		if _, err := r.stmt(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *stmtRegistry) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	r.mu.RLock()
+	stmt, ok := r.stmts[query]
+	r.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	// prepared outside the lock, the database round trip shouldn't hold up every other query
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		statementMetrics.Add("prepare_errors", 1)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.stmts[query]; ok { // someone else was quicker
+		stmt.Close()
+		return existing, nil
+	}
+	r.stmts[query] = stmt
+	statementMetrics.Add("prepared", 1)
+	return stmt, nil
+}
+
+// prepared returns the statement for query if it is ready. Otherwise query gets prepared in
+// the background, for transactions: preparing takes a connection of its own, and waiting for
+// one while holding the transaction's could starve a full pool.
+func (r *stmtRegistry) prepared(query string) (*sql.Stmt, bool) {
+	r.mu.RLock()
+	stmt, ok := r.stmts[query]
+	r.mu.RUnlock()
+	if !ok {
+		r.queue(query)
+	}
+	return stmt, ok
+}
+
+// queue has query prepared in the background. A single goroutine works through the queue and
+// stops once it is empty, however many transactions ask at once.
+func (r *stmtRegistry) queue(query string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.stmts[query]; ok || r.queued[query] {
+		return
+	}
+	r.queued[query] = true
+	if !r.preparing {
+		r.preparing = true
+		go r.prepareQueued()
+	}
+}
+
+func (r *stmtRegistry) prepareQueued() {
+	for {
+		r.mu.Lock()
+		var query string
+		for query = range r.queued {
+			break
+		}
+		if query == "" {
+			r.preparing = false
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+
+		r.stmt(context.Background(), query) // a failure is counted, the next transaction queues it again
+		r.mu.Lock()
+		delete(r.queued, query)
+		r.mu.Unlock()
+	}
+}
+
+// preparedDB is a *sql.DB that runs every query through its stmtRegistry. It is a queryer,
+// so none of the store helpers need to know.
+type preparedDB struct {
+	*sql.DB
+	stmts *stmtRegistry
+}
+
+// poolConfig is how many connections the sql stores keep, see TODOAPP_DB_* in config.go
+type poolConfig struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+}
+
+// newPreparedDB applies the pool limits to db and prepares queries up front
+func newPreparedDB(db *sql.DB, pool poolConfig, queries ...string) (*preparedDB, error) {
+	db.SetMaxOpenConns(pool.maxOpenConns)
+	db.SetMaxIdleConns(pool.maxIdleConns)
+	db.SetConnMaxLifetime(pool.connMaxLifetime)
+	db.SetConnMaxIdleTime(pool.connMaxIdleTime)
+
+	stmts, err := newStmtRegistry(context.Background(), db, queries...)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedDB{DB: db, stmts: stmts}, nil
+}
+
+// The query methods fall back to the unprepared query when preparing fails, which fails
+// the same way and hands back the error where the caller expects it.
+
+func (p *preparedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := p.stmts.stmt(ctx, query)
+	if err != nil {
+		return p.DB.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (p *preparedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := p.stmts.stmt(ctx, query)
+	if err != nil {
+		return p.DB.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (p *preparedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := p.stmts.stmt(ctx, query)
+	if err != nil {
+		return p.DB.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+func (p *preparedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*preparedTx, error) {
+	tx, err := p.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedTx{Tx: tx, stmts: p.stmts}, nil
+}
+
+// preparedTx is preparedDB inside a transaction, the statements are bound to it with Tx.StmtContext.
+// Queries the registry hasn't prepared yet run as they are, see stmtRegistry.prepared.
+type preparedTx struct {
+	*sql.Tx
+	stmts *stmtRegistry
+}
+
+func (t *preparedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt, ok := t.stmts.prepared(query); ok {
+		return t.Tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	}
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (t *preparedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt, ok := t.stmts.prepared(query); ok {
+		return t.Tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+	}
+	return t.Tx.QueryContext(ctx, query, args...)
+}
+
+func (t *preparedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt, ok := t.stmts.prepared(query); ok {
+		return t.Tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	}
+	return t.Tx.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSQLiteListDoesNotGrowTheRegistry(t *testing.T) {
+	s := openTestSQLite(t)
+	ctx := context.Background()
+	s.List(ctx, todoFilter{tags: []string{"a"}})
+	before := len(s.db.stmts.stmts)
+
+	var tags []string
+	for i := range 50 {
+		tags = append(tags, fmt.Sprint("tag", i))
+		if _, err := s.List(ctx, todoFilter{tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := len(s.db.stmts.stmts); after != before {
+		t.Errorf("50 different tag counts went from %d to %d statements", before, after)
+	}
+}
+
+func TestTransactionsPrepareInTheBackground(t *testing.T) {
+	s := openTestSQLite(t)
+	ctx := context.Background()
+
+	queries := make([]string, 20)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("SELECT %d", i)
+	}
+	for range 5 {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range queries {
+			var n int
+			if err := tx.QueryRowContext(ctx, q).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tx.Rollback()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.db.stmts.mu.RLock()
+		missing, busy := 0, s.db.stmts.preparing
+		for _, q := range queries {
+			if _, ok := s.db.stmts.stmts[q]; !ok {
+				missing++
+			}
+		}
+		s.db.stmts.mu.RUnlock()
+		if missing == 0 && !busy {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d queries still not prepared", missing)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// The unprepared runs go straight to the *sql.DB underneath the registry
+func BenchmarkSQLiteQueries(b *testing.B) {
+	s := openTestSQLite(b)
+	ctx := context.Background()
+	for i := range 200 {
+		if _, err := s.Create(ctx, todo{description: fmt.Sprint("todo ", i), tags: []string{fmt.Sprint("tag", i%5)}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, q := range []struct {
+		name string
+		q    queryer
+	}{{"prepared", s.db}, {"unprepared", s.db.DB}} {
+		b.Run("List/"+q.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := sqliteQueryTodos(ctx, q.q, sqliteListQuery(nil), workspaceOf(ctx)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("Get/"+q.name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				if _, err := sqliteGetTodo(ctx, q.q, i%200+1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPostgresQueries(b *testing.B) {
+	s, err := newPostgresStore(openTestPostgres(b), testPool, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range 200 {
+		if _, err := s.Create(ctx, todo{description: fmt.Sprint("todo ", i), tags: []string{fmt.Sprint("tag", i%5)}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, q := range []struct {
+		name string
+		q    queryer
+	}{{"prepared", s.db}, {"unprepared", s.db.DB}} {
+		b.Run("List/"+q.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := queryTodos(ctx, q.q, listQuery(nil), workspaceOf(ctx)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("Get/"+q.name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				if _, err := getTodo(ctx, q.q, i%200+1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
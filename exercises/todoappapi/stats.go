@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// todoStats is what GET /todos/stats answers with
+type todoStats struct {
+	Total   int
+	Open    int
+	Done    int
+	Overdue int // open todos due before today
+	// CompletedByWeek has one entry per week, oldest first, including weeks without completions
+	CompletedByWeek []weekCount
+	// AverageSecondsToDone is from creation to completion over every todo with both
+	// timestamps, nil when there are none
+	AverageSecondsToDone *float64
+}
+
+// weekCount is how many todos were completed in the week starting on Monday Week
+type weekCount struct {
+	Week      string
+	Completed int
+}
+
+// GET /todos/stats?weeks=8 counts todos by status and shows completions for the last weeks
+func stats(rw http.ResponseWriter, r *http.Request) {
+	weeks := 8
+	if raw := r.URL.Query().Get("weeks"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 52 {
+			writeError(rw, http.StatusBadRequest, "invalid_query", "weeks has to be a number between 1 and 52")
+			return
+		}
+		weeks = n
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // duedate is a plain date
+	since := weekStart(today).AddDate(0, 0, -7*(weeks-1))
+
+	s, err := store.Stats(r.Context(), today, since)
+	if err != nil {
+		writeStoreError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, s)
+}
+
+// weekStart is the Monday of the week t is in
+func weekStart(t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+// completionTrend turns completions per week, keyed by the Monday as YYYY-MM-DD, into one
+// weekCount for every week from since up to the one today is in
+func completionTrend(since, today time.Time, completed map[string]int) []weekCount {
+	var trend []weekCount
+	for week := weekStart(since); !week.After(today); week = week.AddDate(0, 0, 7) {
+		key := week.Format(time.DateOnly)
+		trend = append(trend, weekCount{Week: key, Completed: completed[key]})
+	}
+	return trend
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// errNotFound is returned by a todoStore when the todo asked for does not exist
+	errNotFound = errors.New("todo not found")
+	// errUnknownReference means a parent or blocker id points at a todo that does not exist
+	errUnknownReference = errors.New("referenced todo does not exist")
+	// errCycle means a parent or blocker change would make a todo depend on itself
+	errCycle = errors.New("change would create a cycle")
+	// errOpenSubtasks and errBlocked are why Complete refuses to mark a todo done. Create,
+	// SetParent and AddBlocker return them too rather than put an open todo under a done one
+	// or a done todo behind an open one.
+	errOpenSubtasks = errors.New("todo has open subtasks")
+	errBlocked      = errors.New("todo is blocked by open todos")
+	// errHasSubtasks is why Delete refuses, subtasks have to be deleted or moved away first
+	errHasSubtasks = errors.New("todo has subtasks, delete or move them first")
+)
+
+// todoStore is everything the handlers need from the storage layer.
+// Keeping the handlers on this interface instead of *sql.DB means they never see SQL.
+type todoStore interface {
+	List(ctx context.Context, filter todoFilter) ([]todo, error)
+	Get(ctx context.Context, id int) (todo, error)
+	Create(ctx context.Context, t todo) (todo, error)
+	// Update overwrites description, done, duedate, priority, tags, project and recurrence of t.id,
+	// parent and blockers have methods of their own. Marking an open todo done is checked like
+	// Complete and creates the next occurrence of the updated todo in the same transaction.
+	// Reopening a done todo is errOpenSubtasks while its parent is done, errBlocked while a done
+	// todo waits for it.
+	Update(ctx context.Context, t todo) (updated todo, next *todo, err error)
+	// Delete removes a todo that has no subtasks. It is errNotFound when there was nothing to
+	// delete, which the apis don't pass on: deleting twice isn't an error for them.
+	Delete(ctx context.Context, id int) error
+	// Import creates all of todos or none of them
+	Import(ctx context.Context, todos []todo) ([]todo, error)
+	// Complete marks a todo done. For recurring todos it also creates the next occurrence
+	// in the same transaction and returns it, next is nil otherwise.
+	Complete(ctx context.Context, id int) (done todo, next *todo, err error)
+
+	// Tree returns the todo with all of its subtasks nested under it, however deep
+	Tree(ctx context.Context, id int) (todo, error)
+	// SetParent makes id a subtask of parent, parent 0 turns it back into a top level todo.
+	// An open todo can't go under a done one.
+	SetParent(ctx context.Context, id, parent int) error
+	// AddBlocker makes id wait for blocker, a done todo can't start waiting for an open one
+	AddBlocker(ctx context.Context, id, blocker int) error
+	RemoveBlocker(ctx context.Context, id, blocker int) error
+
+	// Search returns up to limit todos whose description matches query, best match first
+	Search(ctx context.Context, query string, limit int) ([]searchResult, error)
+
+	// Stats counts todos by status. Overdue is relative to today, the completion trend starts
+	// with the week since is in.
+	Stats(ctx context.Context, today, since time.Time) (todoStats, error)
+
+	// Export calls todo for every todo by id and then reminder for every reminder that went out,
+	// all read in one go so they are consistent with each other
+	Export(ctx context.Context, todo func(storedTodo) error, reminder func(sentReminder) error) error
+	// Restore writes todos and reminders back with their ids and timestamps, all or nothing.
+	// The store has to be empty unless replace is set, which deletes everything first.
+	Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error
+}
+
+// todoFilter narrows down List. Zero values mean "don't filter on this".
+type todoFilter struct {
+	priority *priority
+	tags     []string // a todo has to carry every one of these tags
+	project  string
+}
+
+// nestSubtasks takes a todo and all of its descendants in any order and hangs every todo
+// under its parent, returning the one with id root
+func nestSubtasks(root int, todos []todo) (todo, error) {
+	children := map[int][]int{}
+	byID := map[int]todo{}
+	for _, t := range todos {
+		byID[t.id] = t
+		children[t.parent] = append(children[t.parent], t.id)
+	}
+	if _, ok := byID[root]; !ok {
+		return todo{}, errNotFound
+	}
+
+	var build func(id int) todo
+	build = func(id int) todo {
+		t := byID[id]
+		for _, child := range children[id] {
+			t.subtasks = append(t.subtasks, build(child))
+		}
+		return t
+	}
+	return build(root), nil
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps todos in a map, which is enough to run the api without postgres.
+// Everything goes through one mutex, and todos are copied on the way in and out
+// so callers can never reach into the map through a shared slice.
+type memoryStore struct {
+	mu         sync.Mutex
+	nextID     int
+	todos      map[int]todo
+	times      map[int]todoTimes
+	workspaces map[int]string            // the workspace every todo is in
+	reminders  map[reminderKey]time.Time // when the reminder went out
+}
+
+// todoTimes is created_at and done_at of the sql stores, which aren't part of the todo model
+type todoTimes struct {
+	created time.Time
+	done    time.Time
+}
+
+type reminderKey struct {
+	todo    int
+	kind    reminderKind
+	duedate time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		nextID:     1,
+		todos:      map[int]todo{},
+		times:      map[int]todoTimes{},
+		workspaces: map[int]string{},
+		reminders:  map[reminderKey]time.Time{},
+	}
+}
+
+func (s *memoryStore) List(ctx context.Context, filter todoFilter) ([]todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var todos []todo
+	for _, t := range s.sortedIn(workspaceOf(ctx)) {
+		if filter.matches(t) {
+			todos = append(todos, cloneTodo(t))
+		}
+	}
+	return todos, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id int) (todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.find(ctx, id)
+	if !ok {
+		return todo{}, errNotFound
+	}
+	return cloneTodo(t), nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, t todo) (todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insert(t, workspaceOf(ctx))
+}
+
+func (s *memoryStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := make([]todo, 0, len(todos))
+	for _, t := range todos {
+		t, err := s.insert(t, workspaceOf(ctx))
+		if err != nil {
+			for _, c := range created { // there is no transaction to roll back, so undo by hand
+				s.delete(c.id)
+			}
+			return nil, err
+		}
+		created = append(created, t)
+	}
+	return created, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.find(ctx, t.id)
+	if !ok {
+		return todo{}, nil, errNotFound
+	}
+	completing := t.done && !current.done
+	if completing {
+		if err := s.completable(current); err != nil {
+			return todo{}, nil, err
+		}
+	}
+	if !t.done && current.done {
+		if err := s.reopenable(current); err != nil {
+			return todo{}, nil, err
+		}
+	}
+	if t.done != current.done {
+		s.setDone(t.id, t.done)
+	}
+	current.description = t.description
+	current.done = t.done
+	current.duedate = t.duedate
+	current.priority = t.priority
+	current.tags = append([]string(nil), t.tags...)
+	current.project = t.project
+	current.recurrence = t.recurrence
+	s.todos[t.id] = current
+
+	var next *todo
+	if n, ok := current.nextOccurrence(time.Now()); completing && ok {
+		n, err := s.insert(n, workspaceOf(ctx))
+		if err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return cloneTodo(current), next, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.find(ctx, id); !ok {
+		return errNotFound
+	}
+	for _, other := range s.todos {
+		if other.parent == id {
+			return errHasSubtasks
+		}
+	}
+	s.delete(id)
+	return nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.find(ctx, id)
+	if !ok {
+		return todo{}, nil, errNotFound
+	}
+	if t.done {
+		return cloneTodo(t), nil, nil
+	}
+
+	if err := s.completable(t); err != nil {
+		return todo{}, nil, err
+	}
+
+	t.done = true
+	s.todos[id] = t
+	s.setDone(id, true)
+
+	var next *todo
+	if n, ok := t.nextOccurrence(time.Now()); ok {
+		n, err := s.insert(n, workspaceOf(ctx))
+		if err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return cloneTodo(t), next, nil
+}
+
+func (s *memoryStore) Tree(ctx context.Context, id int) (todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.find(ctx, id); !ok {
+		return todo{}, errNotFound
+	}
+
+	var tree []todo
+	for _, t := range s.sortedIn(workspaceOf(ctx)) {
+		if t.id == id || s.isDescendant(t.id, id) {
+			tree = append(tree, cloneTodo(t))
+		}
+	}
+	return nestSubtasks(id, tree)
+}
+
+func (s *memoryStore) SetParent(ctx context.Context, id, parent int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.find(ctx, id)
+	if !ok {
+		return errNotFound
+	}
+	if parent != 0 {
+		if _, ok := s.find(ctx, parent); !ok {
+			return errUnknownReference
+		}
+		if parent == id || s.isDescendant(parent, id) {
+			return errCycle
+		}
+		if s.todos[parent].done && !t.done {
+			return errOpenSubtasks
+		}
+	}
+
+	t.parent = parent
+	s.todos[id] = t
+	return nil
+}
+
+func (s *memoryStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.find(ctx, id)
+	if !ok {
+		return errNotFound
+	}
+	if _, ok := s.find(ctx, blocker); !ok {
+		return errUnknownReference
+	}
+	if blocker == id || s.waitsOn(blocker, id) {
+		return errCycle
+	}
+	if t.done && !s.todos[blocker].done {
+		return errBlocked
+	}
+
+	for _, b := range t.blockedBy {
+		if b == blocker {
+			return nil
+		}
+	}
+	t.blockedBy = append(append([]int(nil), t.blockedBy...), blocker)
+	sort.Ints(t.blockedBy)
+	s.todos[id] = t
+	return nil
+}
+
+func (s *memoryStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.find(ctx, id); ok {
+		t.blockedBy = withoutID(t.blockedBy, blocker)
+		s.todos[id] = t
+	}
+	return nil
+}
+
+// Search has no stemming or stop words, it is the plain token matching from matchTokens
+func (s *memoryStore) Search(ctx context.Context, query string, limit int) ([]searchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := searchTokens(query)
+	var results []searchResult
+	for _, t := range s.sortedIn(workspaceOf(ctx)) {
+		if rank, snippet, ok := matchTokens(t.description, tokens); ok {
+			results = append(results, searchResult{Todo: cloneTodo(t), Rank: rank, Snippet: snippet})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *memoryStore) Stats(ctx context.Context, today, since time.Time) (todoStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		stats     todoStats
+		completed = map[string]int{}
+		toDone    time.Duration
+		timed     int
+	)
+	for _, t := range s.sortedIn(workspaceOf(ctx)) {
+		stats.Total++
+		if !t.done {
+			stats.Open++
+			if !t.duedate.IsZero() && t.duedate.Before(today) {
+				stats.Overdue++
+			}
+			continue
+		}
+
+		stats.Done++
+		times := s.times[t.id]
+		if times.done.IsZero() {
+			continue
+		}
+		toDone += times.done.Sub(times.created)
+		timed++
+		if !times.done.Before(since) {
+			completed[weekStart(times.done).Format(time.DateOnly)]++
+		}
+	}
+
+	stats.CompletedByWeek = completionTrend(since, today, completed)
+	if timed > 0 {
+		avg := toDone.Seconds() / float64(timed)
+		stats.AverageSecondsToDone = &avg
+	}
+	return stats, nil
+}
+
+func (s *memoryStore) Export(ctx context.Context, todo func(storedTodo) error, reminder func(sentReminder) error) error {
+	// copied out first, the callbacks write to the network and shouldn't do that holding the lock
+	s.mu.Lock()
+	var (
+		todos     []storedTodo
+		reminders []sentReminder
+		workspace = workspaceOf(ctx)
+	)
+	for _, t := range s.sortedIn(workspace) {
+		times := s.times[t.id]
+		todos = append(todos, storedTodo{todo: cloneTodo(t), createdAt: times.created, doneAt: times.done})
+	}
+	for key, sentAt := range s.reminders {
+		if s.workspaces[key.todo] != workspace {
+			continue
+		}
+		reminders = append(reminders, sentReminder{todo: key.todo, kind: key.kind, duedate: key.duedate, sentAt: sentAt})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(reminders, func(i, j int) bool {
+		if reminders[i].todo != reminders[j].todo {
+			return reminders[i].todo < reminders[j].todo
+		}
+		return reminders[i].sentAt.Before(reminders[j].sentAt)
+	})
+	for _, t := range todos {
+		if err := todo(t); err != nil {
+			return err
+		}
+	}
+	for _, r := range reminders {
+		if err := reminder(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore builds the new state on the side and swaps it in, which is as good as a transaction.
+// The side copy starts out with everything but the workspace being restored.
+func (s *memoryStore) Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace := workspaceOf(ctx)
+	if len(s.sortedIn(workspace)) > 0 && !replace {
+		return errNotEmpty
+	}
+
+	restored := newMemoryStore()
+	restored.nextID = s.nextID
+	for id, t := range s.todos {
+		if s.workspaces[id] != workspace {
+			restored.todos[id], restored.times[id], restored.workspaces[id] = t, s.times[id], s.workspaces[id]
+		}
+	}
+	for key, sentAt := range s.reminders {
+		if _, ok := restored.todos[key.todo]; ok {
+			restored.reminders[key] = sentAt
+		}
+	}
+
+	for _, t := range todos {
+		if _, ok := restored.todos[t.id]; ok {
+			return errIDTaken
+		}
+		restored.todos[t.id] = cloneTodo(t.todo)
+		restored.times[t.id] = todoTimes{created: t.createdAt, done: t.doneAt}
+		restored.workspaces[t.id] = workspace
+		restored.nextID = max(restored.nextID, t.id+1)
+	}
+	for _, t := range todos {
+		if t.parent != 0 && restored.workspaces[t.parent] != workspace {
+			return errUnknownReference
+		}
+		for _, b := range t.blockedBy {
+			if restored.workspaces[b] != workspace {
+				return errUnknownReference
+			}
+		}
+	}
+	for _, r := range reminders {
+		if restored.workspaces[r.todo] != workspace {
+			return errUnknownReference
+		}
+		restored.reminders[reminderKey{todo: r.todo, kind: r.kind, duedate: r.duedate}] = r.sentAt
+	}
+
+	s.nextID, s.todos, s.times, s.workspaces, s.reminders = restored.nextID, restored.todos, restored.times, restored.workspaces, restored.reminders
+	return nil
+}
+
+func (s *memoryStore) PendingReminders(_ context.Context, today, horizon time.Time) ([]reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []reminder
+	for _, t := range s.sorted() {
+		if t.done || t.duedate.IsZero() || t.duedate.After(horizon) {
+			continue
+		}
+		r := reminder{todo: cloneTodo(t), kind: reminderKindFor(t.duedate, today)}
+		if _, sent := s.reminders[keyFor(r)]; !sent {
+			pending = append(pending, r)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].todo.duedate.Before(pending[j].todo.duedate) })
+	return pending, nil
+}
+
+func (s *memoryStore) ClaimReminder(_ context.Context, r reminder) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, sent := s.reminders[keyFor(r)]; sent {
+		return false, nil
+	}
+	s.reminders[keyFor(r)] = time.Now().UTC()
+	return true, nil
+}
+
+func (s *memoryStore) ReleaseReminder(_ context.Context, r reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reminders, keyFor(r))
+	return nil
+}
+
+func keyFor(r reminder) reminderKey {
+	return reminderKey{todo: r.todo.id, kind: r.kind, duedate: r.todo.duedate}
+}
+
+// insert, delete and the helpers below expect s.mu to be held
+
+func (s *memoryStore) insert(t todo, workspace string) (todo, error) {
+	if t.parent != 0 {
+		if s.workspaces[t.parent] != workspace {
+			return todo{}, errUnknownReference
+		}
+		if s.todos[t.parent].done && !t.done {
+			return todo{}, errOpenSubtasks
+		}
+	}
+	for _, blocker := range t.blockedBy {
+		if s.workspaces[blocker] != workspace {
+			return todo{}, errUnknownReference
+		}
+		if t.done && !s.todos[blocker].done {
+			return todo{}, errBlocked
+		}
+	}
+
+	t = cloneTodo(t)
+	t.id = s.nextID
+	t.subtasks = nil
+	s.nextID++
+	s.todos[t.id] = t
+	s.times[t.id] = todoTimes{created: time.Now().UTC()}
+	s.workspaces[t.id] = workspace
+	s.setDone(t.id, t.done)
+	return cloneTodo(t), nil
+}
+
+// completable is errOpenSubtasks or errBlocked when t can't be marked done yet
+func (s *memoryStore) completable(t todo) error {
+	for _, other := range s.todos {
+		if other.parent == t.id && !other.done {
+			return errOpenSubtasks
+		}
+	}
+	for _, blocker := range t.blockedBy {
+		if !s.todos[blocker].done {
+			return errBlocked
+		}
+	}
+	return nil
+}
+
+// reopenable is errOpenSubtasks when t's parent is done, errBlocked when a done todo waits for t
+func (s *memoryStore) reopenable(t todo) error {
+	if t.parent != 0 && s.todos[t.parent].done {
+		return errOpenSubtasks
+	}
+	for _, other := range s.todos {
+		if other.done && slices.Contains(other.blockedBy, t.id) {
+			return errBlocked
+		}
+	}
+	return nil
+}
+
+// setDone keeps the done timestamp of id in step with its done flag
+func (s *memoryStore) setDone(id int, done bool) {
+	times := s.times[id]
+	times.done = time.Time{}
+	if done {
+		times.done = time.Now().UTC()
+	}
+	s.times[id] = times
+}
+
+// delete removes id along with its subtasks, the same way the ON DELETE CASCADEs do in postgres.
+// Delete makes sure there are none, Import undoing its inserts doesn't need to.
+func (s *memoryStore) delete(id int) {
+	if _, ok := s.todos[id]; !ok {
+		return
+	}
+	delete(s.todos, id)
+	delete(s.times, id)
+	delete(s.workspaces, id)
+
+	for otherID, other := range s.todos {
+		if other.parent == id {
+			s.delete(otherID)
+			continue
+		}
+		if blockedBy := withoutID(other.blockedBy, id); len(blockedBy) != len(other.blockedBy) {
+			other.blockedBy = blockedBy
+			s.todos[otherID] = other
+		}
+	}
+	for key := range s.reminders {
+		if key.todo == id {
+			delete(s.reminders, key)
+		}
+	}
+}
+
+// find is s.todos[id] for todos in the workspace of ctx, the others don't exist as far as
+// requests for it are concerned
+func (s *memoryStore) find(ctx context.Context, id int) (todo, bool) {
+	t, ok := s.todos[id]
+	if !ok || s.workspaces[id] != workspaceOf(ctx) {
+		return todo{}, false
+	}
+	return t, true
+}
+
+// sortedIn is sorted narrowed down to one workspace
+func (s *memoryStore) sortedIn(workspace string) []todo {
+	var todos []todo
+	for _, t := range s.sorted() {
+		if s.workspaces[t.id] == workspace {
+			todos = append(todos, t)
+		}
+	}
+	return todos
+}
+
+func (s *memoryStore) sorted() []todo {
+	todos := make([]todo, 0, len(s.todos))
+	for _, t := range s.todos {
+		todos = append(todos, t)
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].id < todos[j].id })
+	return todos
+}
+
+// isDescendant reports whether id sits somewhere below ancestor
+func (s *memoryStore) isDescendant(id, ancestor int) bool {
+	for seen := map[int]bool{}; id != 0 && !seen[id]; {
+		seen[id] = true
+		id = s.todos[id].parent
+		if id == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// waitsOn reports whether id is blocked by target, directly or through other blockers
+func (s *memoryStore) waitsOn(id, target int) bool {
+	seen := map[int]bool{}
+	queue := []int{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, blocker := range s.todos[current].blockedBy {
+			if blocker == target {
+				return true
+			}
+			if !seen[blocker] {
+				seen[blocker] = true
+				queue = append(queue, blocker)
+			}
+		}
+	}
+	return false
+}
+
+func (f todoFilter) matches(t todo) bool {
+	if f.priority != nil && t.priority != *f.priority {
+		return false
+	}
+	if f.project != "" && t.project != f.project {
+		return false
+	}
+	for _, want := range f.tags {
+		found := false
+		for _, tag := range t.tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func cloneTodo(t todo) todo {
+	t.tags = append([]string(nil), t.tags...)
+	t.blockedBy = append([]int(nil), t.blockedBy...)
+	t.subtasks = append([]todo(nil), t.subtasks...)
+	return t
+}
+
+func withoutID(ids []int, id int) []int {
+	var out []int
+	for _, other := range ids {
+		if other != id {
+			out = append(out, other)
+		}
+	}
+	return out
+}
@@ -0,0 +1,848 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type postgresStore struct {
+	db  *preparedDB
+	rls bool // see begin
+}
+
+// newPostgresStore prepares what nearly every request runs up front, which also makes a
+// database without the schema fail at startup instead of on the first request
+func newPostgresStore(db *sql.DB, pool poolConfig, rls bool) (*postgresStore, error) {
+	err := checkSchema(context.Background(), db, postgresTableColumns, postgresTodoColumns.columns(), postgresUnmappedColumns...)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := newPreparedDB(db, pool, getTodoQuery, listQuery(nil), insertTodoQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresStore{db: prepared, rls: rls}, nil
+}
+
+// begin starts a transaction. With row level security on it runs as todoapp_workspace with
+// todoapp.workspace set to the workspace of ctx, which puts it under the policies from
+// migrations/0008_workspaces.sql. The queries scope themselves all the same, the policies are
+// for the one that forgets to.
+func (s *postgresStore) begin(ctx context.Context, opts *sql.TxOptions) (*preparedTx, error) {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil || !s.rls {
+		return tx, err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT set_config('role', 'todoapp_workspace', true), set_config('todoapp.workspace', $1, true)`, workspaceOf(ctx))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// scoped runs fn straight on the pool, or in a transaction from begin when row level security
+// is on, which is what every method that doesn't need a transaction of its own goes through
+func (s *postgresStore) scoped(ctx context.Context, fn func(q queryer) error) error {
+	if !s.rls {
+		return fn(s.db)
+	}
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const postgresTableColumns = `SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'todos'`
+
+// postgresUnmappedColumns are the todos columns that aren't read into the model
+var postgresUnmappedColumns = []string{"search", "created_at", "done_at", "workspace"}
+
+// postgresTodoRow is a todo the way selectTodos reads it, before the nulls and arrays are unpacked
+type postgresTodoRow struct {
+	todo
+	nullDuedate   sql.NullTime
+	rawRecurrence sql.NullString
+	blockers      []int64 // pq.Array can only scan into the 64 bit variant
+}
+
+// Every read joins the project name in and folds the tags into a single array column,
+// so one row still maps to one todo
+var postgresTodoColumns = rowMapping[postgresTodoRow]{
+	{"id", "id", "t.id", func(r *postgresTodoRow) any { return &r.id }},
+	{"description", "description", "t.description", func(r *postgresTodoRow) any { return &r.description }},
+	{"done", "done", "t.done", func(r *postgresTodoRow) any { return &r.done }},
+	{"duedate", "duedate", "t.duedate", func(r *postgresTodoRow) any { return &r.nullDuedate }},
+	{"priority", "priority", "t.priority", func(r *postgresTodoRow) any { return &r.priority }},
+	{"recurrence", "recurrence", "t.recurrence", func(r *postgresTodoRow) any { return &r.rawRecurrence }},
+	{"parent", "parent_id", "COALESCE(t.parent_id, 0)", func(r *postgresTodoRow) any { return &r.parent }},
+	{"project", "project_id", "COALESCE(p.name, '')", func(r *postgresTodoRow) any { return &r.project }},
+	{"tags", "", "COALESCE(array_agg(g.name ORDER BY g.name) FILTER (WHERE g.name IS NOT NULL), '{}')", func(r *postgresTodoRow) any { return pq.Array(&r.tags) }},
+	{"blockedBy", "", "ARRAY(SELECT b.blocked_by_id FROM todo_blockers b WHERE b.todo_id = t.id ORDER BY b.blocked_by_id)", func(r *postgresTodoRow) any { return pq.Array(&r.blockers) }},
+}
+
+var selectTodos = `
+SELECT ` + postgresTodoColumns.selectList() + `
+FROM todos t
+LEFT JOIN projects p ON p.id = t.project_id
+LEFT JOIN todo_tags tt ON tt.todo_id = t.id
+LEFT JOIN tags g ON g.id = tt.tag_id`
+
+func (s *postgresStore) List(ctx context.Context, filter todoFilter) (todos []todo, err error) {
+	var (
+		where []string
+		args  = []any{workspaceOf(ctx)}
+	)
+	if filter.priority != nil {
+		args = append(args, *filter.priority)
+		where = append(where, fmt.Sprintf("t.priority = $%d", len(args)))
+	}
+	if filter.project != "" {
+		args = append(args, filter.project)
+		where = append(where, fmt.Sprintf("p.name = $%d", len(args)))
+	}
+	if len(filter.tags) > 0 {
+		args = append(args, pq.Array(filter.tags))
+		where = append(where, fmt.Sprintf(`t.id IN (
+	SELECT tt.todo_id FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id
+	WHERE g.name = ANY($%[1]d)
+	GROUP BY tt.todo_id HAVING count(*) = (SELECT count(DISTINCT tag) FROM unnest($%[1]d::text[]) tag))`, len(args)))
+	}
+
+	err = s.scoped(ctx, func(q queryer) error {
+		todos, err = queryTodos(ctx, q, listQuery(where), args...)
+		return err
+	})
+	return todos, err
+}
+
+// listQuery selects the todos of workspace $1 that match every condition in where
+func listQuery(where []string) string {
+	query := selectTodos + "\nWHERE " + strings.Join(append([]string{"t.workspace = $1"}, where...), " AND ")
+	return query + "\nGROUP BY t.id, p.name ORDER BY t.id"
+}
+
+func (s *postgresStore) Get(ctx context.Context, id int) (t todo, err error) {
+	err = s.scoped(ctx, func(q queryer) error {
+		t, err = getTodo(ctx, q, id)
+		return err
+	})
+	return t, err
+}
+
+func (s *postgresStore) Create(ctx context.Context, t todo) (todo, error) {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return todo{}, err
+	}
+	defer tx.Rollback() // no-op once the tx is committed
+
+	if t, err = insertTodo(ctx, tx, t); err != nil {
+		return todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+func (s *postgresStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]todo, len(todos))
+	for i, t := range todos {
+		if created[i], err = insertTodo(ctx, tx, t); err != nil {
+			return nil, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+func (s *postgresStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	defer tx.Rollback()
+
+	// the lock is Complete's, only one of them gets to mark the todo done and spawn its next occurrence
+	var wasDone bool
+	err = tx.QueryRowContext(ctx, `SELECT done FROM todos WHERE id = $1 AND workspace = $2 FOR UPDATE`, t.id, workspaceOf(ctx)).Scan(&wasDone)
+	if err == sql.ErrNoRows {
+		return todo{}, nil, errNotFound
+	}
+	if err != nil {
+		return todo{}, nil, err
+	}
+	completing := t.done && !wasDone
+	if completing {
+		if err := checkCompletable(ctx, tx, t.id); err != nil {
+			return todo{}, nil, err
+		}
+	}
+	if !t.done && wasDone {
+		if err := checkReopenable(ctx, tx, t.id, " FOR SHARE OF o"); err != nil {
+			return todo{}, nil, err
+		}
+	}
+
+	projectID, err := lookupProject(ctx, tx, t.project)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE todos SET description = $2, done = $3, duedate = $4, priority = $5, recurrence = $6, project_id = $7 WHERE id = $1`,
+		t.id, t.description, t.done, nullTime(t.duedate), t.priority, nullString(t.recurrence.String()), projectID)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	if err := replaceTags(ctx, tx, t.id, t.tags); err != nil {
+		return todo{}, nil, err
+	}
+
+	if t, err = getTodo(ctx, tx, t.id); err != nil {
+		return todo{}, nil, err
+	}
+	var next *todo
+	if n, ok := t.nextOccurrence(time.Now()); completing && ok {
+		if n, err = insertTodo(ctx, tx, n); err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return t, next, tx.Commit()
+}
+
+func (s *postgresStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the row means only one request gets to flip done and spawn the next occurrence,
+	// completing the same todo twice doesn't create two follow-ups
+	var alreadyDone bool
+	err = tx.QueryRowContext(ctx, `SELECT done FROM todos WHERE id = $1 AND workspace = $2 FOR UPDATE`, id, workspaceOf(ctx)).Scan(&alreadyDone)
+	if err == sql.ErrNoRows {
+		return todo{}, nil, errNotFound
+	}
+	if err != nil {
+		return todo{}, nil, err
+	}
+	if alreadyDone {
+		t, err := getTodo(ctx, tx, id)
+		if err != nil {
+			return todo{}, nil, err
+		}
+		return t, nil, tx.Commit()
+	}
+
+	if err := checkCompletable(ctx, tx, id); err != nil {
+		return todo{}, nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE todos SET done = true WHERE id = $1`, id); err != nil {
+		return todo{}, nil, err
+	}
+	t, err := getTodo(ctx, tx, id)
+	if err != nil {
+		return todo{}, nil, err
+	}
+
+	var next *todo
+	if n, ok := t.nextOccurrence(time.Now()); ok {
+		if n, err = insertTodo(ctx, tx, n); err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return t, next, tx.Commit()
+}
+
+// Tree only checks the workspace of the root, subtasks are always in the workspace of their parent
+func (s *postgresStore) Tree(ctx context.Context, id int) (todo, error) {
+	var todos []todo
+	err := s.scoped(ctx, func(q queryer) (err error) {
+		todos, err = queryTodos(ctx, q, `
+WITH RECURSIVE tree (id) AS (
+	SELECT id FROM todos WHERE id = $1 AND workspace = $2
+	UNION
+	SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id
+)`+selectTodos+`
+WHERE t.id IN (SELECT id FROM tree) GROUP BY t.id, p.name ORDER BY t.id`, id, workspaceOf(ctx))
+		return err
+	})
+	if err != nil {
+		return todo{}, err
+	}
+	return nestSubtasks(id, todos)
+}
+
+func (s *postgresStore) SetParent(ctx context.Context, id, parent int) error {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Two concurrent moves could each pass the cycle check and still make a cycle together,
+	// so they take turns
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('todos.parent_id'))`); err != nil {
+		return err
+	}
+
+	if parent != 0 {
+		if err := inWorkspace(ctx, tx, parent, errUnknownReference); err != nil {
+			return err
+		}
+		// id cannot go under parent if id is parent itself or one of parent's ancestors
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `
+WITH RECURSIVE ancestors (id) AS (
+	SELECT $2::integer
+	UNION
+	SELECT t.parent_id FROM todos t JOIN ancestors a ON t.id = a.id WHERE t.parent_id IS NOT NULL
+)
+SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)`, id, parent).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errCycle
+		}
+		if err := checkParentDone(ctx, tx, id, parent, " FOR SHARE OF p"); err != nil {
+			return err
+		}
+	}
+
+	var parentID sql.NullInt64
+	if parent != 0 {
+		parentID = sql.NullInt64{Int64: int64(parent), Valid: true}
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE todos SET parent_id = $2 WHERE id = $1 AND workspace = $3`, id, parentID, workspaceOf(ctx))
+	if err != nil {
+		return referenceError(err)
+	}
+	if err := expectOneRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *postgresStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	if id == blocker {
+		return errCycle
+	}
+
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('todo_blockers'))`); err != nil {
+		return err
+	}
+
+	if _, err := getTodo(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := inWorkspace(ctx, tx, blocker, errUnknownReference); err != nil {
+		return err
+	}
+
+	// id blocked by blocker is a cycle if blocker already waits on id, directly or further down the chain
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `
+WITH RECURSIVE chain (id) AS (
+	SELECT $2::integer
+	UNION
+	SELECT b.blocked_by_id FROM todo_blockers b JOIN chain c ON b.todo_id = c.id
+)
+SELECT EXISTS (SELECT 1 FROM chain WHERE id = $1)`, id, blocker).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return errCycle
+	}
+	if err := checkBlockerDone(ctx, tx, id, blocker, " FOR SHARE OF b"); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, blocker)
+	if err != nil {
+		return referenceError(err)
+	}
+	return tx.Commit()
+}
+
+func (s *postgresStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	return s.scoped(ctx, func(q queryer) error {
+		_, err := q.ExecContext(ctx, `
+DELETE FROM todo_blockers
+WHERE todo_id = $1 AND blocked_by_id = $2 AND todo_id IN (SELECT id FROM todos WHERE workspace = $3)`,
+			id, blocker, workspaceOf(ctx))
+		return err
+	})
+}
+
+func (s *postgresStore) Search(ctx context.Context, query string, limit int) (results []searchResult, err error) {
+	err = s.scoped(ctx, func(q queryer) error {
+		results, err = searchTodos(ctx, q, query, limit)
+		return err
+	})
+	return results, err
+}
+
+// searchTodos ranks with ts_rank and highlights with ts_headline over the generated search column.
+// websearch_to_tsquery accepts what people type into search boxes ("quoted phrases", -excluded, or).
+func searchTodos(ctx context.Context, q queryer, query string, limit int) ([]searchResult, error) {
+	rows, err := q.QueryContext(ctx, `
+SELECT t.id, ts_rank(t.search, q),
+	ts_headline('english', t.description, q, 'StartSel=`+highlightStart+`, StopSel=`+highlightStop+`, HighlightAll=true')
+FROM todos t, websearch_to_tsquery('english', $1) q
+WHERE t.search @@ q AND t.workspace = $3
+ORDER BY 2 DESC, t.id
+LIMIT $2`, query, limit, workspaceOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results []searchResult
+		ids     []int64
+	)
+	for rows.Next() {
+		var res searchResult
+		if err := rows.Scan(&res.Todo.id, &res.Rank, &res.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+		ids = append(ids, int64(res.Todo.id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	// the ranking query only has ids, the full todos come from the usual select
+	todos, err := queryTodos(ctx, q, selectTodos+"\nWHERE t.id = ANY($1) AND t.workspace = $2 GROUP BY t.id, p.name", pq.Array(ids), workspaceOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]todo{}
+	for _, t := range todos {
+		byID[t.id] = t
+	}
+
+	found := results[:0]
+	for _, res := range results {
+		if t, ok := byID[res.Todo.id]; ok { // skips todos deleted in between the two queries
+			res.Todo = t
+			found = append(found, res)
+		}
+	}
+	return found, nil
+}
+
+func (s *postgresStore) Stats(ctx context.Context, today, since time.Time) (stats todoStats, err error) {
+	err = s.scoped(ctx, func(q queryer) error {
+		stats, err = queryStats(ctx, q, today, since)
+		return err
+	})
+	return stats, err
+}
+
+// queryStats is two aggregations, one over every todo for the counts and the average, and one
+// grouping the completions since since by the week they fall in
+func queryStats(ctx context.Context, q queryer, today, since time.Time) (todoStats, error) {
+	var (
+		stats todoStats
+		avg   sql.NullFloat64
+	)
+	err := q.QueryRowContext(ctx, `
+SELECT count(*),
+	count(*) FILTER (WHERE NOT done),
+	count(*) FILTER (WHERE done),
+	count(*) FILTER (WHERE NOT done AND duedate < $1),
+	EXTRACT(EPOCH FROM avg(done_at - created_at))
+FROM todos
+WHERE workspace = $2`, today, workspaceOf(ctx)).Scan(&stats.Total, &stats.Open, &stats.Done, &stats.Overdue, &avg)
+	if err != nil {
+		return todoStats{}, err
+	}
+	if avg.Valid {
+		stats.AverageSecondsToDone = &avg.Float64
+	}
+
+	rows, err := q.QueryContext(ctx, `
+SELECT date_trunc('week', done_at AT TIME ZONE 'UTC')::date, count(*)
+FROM todos
+WHERE done_at >= $1 AND workspace = $2
+GROUP BY 1`, since, workspaceOf(ctx))
+	if err != nil {
+		return todoStats{}, err
+	}
+	defer rows.Close()
+
+	completed := map[string]int{}
+	for rows.Next() {
+		var (
+			week time.Time
+			n    int
+		)
+		if err := rows.Scan(&week, &n); err != nil {
+			return todoStats{}, err
+		}
+		completed[week.Format(time.DateOnly)] = n
+	}
+	if err := rows.Err(); err != nil {
+		return todoStats{}, err
+	}
+	stats.CompletedByWeek = completionTrend(since, today, completed)
+	return stats, nil
+}
+
+// Delete locks the todo before it looks for subtasks. A subtask being created at the same time
+// holds a key share lock on it for its foreign key, so one of the two waits for the other.
+func (s *postgresStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasSubtasks bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1) FROM todos WHERE id = $1 AND workspace = $2 FOR UPDATE`, id, workspaceOf(ctx)).Scan(&hasSubtasks)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if hasSubtasks {
+		return errHasSubtasks
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx and their prepared versions, so the helpers below
+// work in and out of transactions
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var getTodoQuery = selectTodos + "\nWHERE t.id = $1 AND t.workspace = $2 GROUP BY t.id, p.name"
+
+func getTodo(ctx context.Context, q queryer, id int) (todo, error) {
+	row := q.QueryRowContext(ctx, getTodoQuery, id, workspaceOf(ctx))
+	t, err := scanTodo(row)
+	if err == sql.ErrNoRows {
+		return todo{}, errNotFound
+	}
+	return t, err
+}
+
+const insertTodoQuery = `INSERT INTO todos (description, done, duedate, priority, recurrence, parent_id, project_id, workspace) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+// insertTodo writes t into the workspace of ctx along with its project and tags and returns it
+// with its new id
+func insertTodo(ctx context.Context, q queryer, t todo) (todo, error) {
+	if err := checkReferences(ctx, q, t, " FOR SHARE"); err != nil {
+		return todo{}, err
+	}
+	projectID, err := lookupProject(ctx, q, t.project)
+	if err != nil {
+		return todo{}, err
+	}
+
+	var parentID sql.NullInt64
+	if t.parent != 0 {
+		parentID = sql.NullInt64{Int64: int64(t.parent), Valid: true}
+	}
+
+	err = q.QueryRowContext(ctx, insertTodoQuery,
+		t.description, t.done, nullTime(t.duedate), t.priority, nullString(t.recurrence.String()), parentID, projectID, workspaceOf(ctx),
+	).Scan(&t.id)
+	if err != nil {
+		return todo{}, referenceError(err)
+	}
+
+	// a brand new todo has nothing depending on it yet, so its blockers cannot form a cycle
+	for _, blocker := range t.blockedBy {
+		if _, err := q.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, t.id, blocker); err != nil {
+			return todo{}, referenceError(err)
+		}
+	}
+
+	if err := replaceTags(ctx, q, t.id, t.tags); err != nil {
+		return todo{}, err
+	}
+	return t, nil
+}
+
+// checkReferences makes sure the parent and blockers of t are in the workspace of ctx, the
+// foreign keys only know that they exist in some workspace. An open todo can't go under a done
+// parent and a done todo can't wait for open blockers either, or Complete's rules would be broken
+// from the start. lock goes at the end of the select, postgres passes FOR SHARE so a Complete of
+// the parent waits for t to be in.
+func checkReferences(ctx context.Context, q queryer, t todo, lock string) error {
+	isDone := func(id int) (bool, error) {
+		var done bool
+		err := q.QueryRowContext(ctx, `SELECT done FROM todos WHERE id = $1 AND workspace = $2`+lock, id, workspaceOf(ctx)).Scan(&done)
+		if err == sql.ErrNoRows {
+			return false, errUnknownReference
+		}
+		return done, err
+	}
+
+	if t.parent != 0 {
+		done, err := isDone(t.parent)
+		if err != nil {
+			return err
+		}
+		if done && !t.done {
+			return errOpenSubtasks
+		}
+	}
+	for _, blocker := range t.blockedBy {
+		done, err := isDone(blocker)
+		if err != nil {
+			return err
+		}
+		if t.done && !done {
+			return errBlocked
+		}
+	}
+	return nil
+}
+
+// checkCompletable is why Complete, or an Update that marks id done, refuses: errOpenSubtasks
+// or errBlocked
+func checkCompletable(ctx context.Context, q queryer, id int) error {
+	var openSubtasks, openBlockers bool
+	err := q.QueryRowContext(ctx, `
+SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1 AND NOT done),
+	EXISTS (SELECT 1 FROM todo_blockers b JOIN todos t ON t.id = b.blocked_by_id WHERE b.todo_id = $1 AND NOT t.done)`,
+		id).Scan(&openSubtasks, &openBlockers)
+	if err != nil {
+		return err
+	}
+	if openSubtasks {
+		return errOpenSubtasks
+	}
+	if openBlockers {
+		return errBlocked
+	}
+	return nil
+}
+
+// checkReopenable is why an Update that reopens id refuses: errOpenSubtasks when its parent is
+// done, errBlocked when a done todo waits for it. lock goes on those other todos, aliased o, so
+// a Complete of one of them can't slip in between the check and the update.
+func checkReopenable(ctx context.Context, q queryer, id int, lock string) error {
+	var parentDone bool
+	err := q.QueryRowContext(ctx, `SELECT o.done FROM todos c JOIN todos o ON o.id = c.parent_id WHERE c.id = $1`+lock, id).Scan(&parentDone)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if parentDone {
+		return errOpenSubtasks
+	}
+
+	// every todo waiting for id is locked, not only the done ones, one about to be completed too
+	rows, err := q.QueryContext(ctx, `SELECT o.done FROM todo_blockers b JOIN todos o ON o.id = b.todo_id WHERE b.blocked_by_id = $1`+lock, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	blocked := false
+	for rows.Next() {
+		var done bool
+		if err := rows.Scan(&done); err != nil {
+			return err
+		}
+		blocked = blocked || done
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	return nil
+}
+
+// checkParentDone is errOpenSubtasks when id is open and parent is done. A missing id is left
+// for the update after it to find.
+func checkParentDone(ctx context.Context, q queryer, id, parent int, lock string) error {
+	var breaks bool
+	err := q.QueryRowContext(ctx, `SELECT p.done AND NOT c.done FROM todos p JOIN todos c ON c.id = $1 WHERE p.id = $2`+lock, id, parent).Scan(&breaks)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if breaks {
+		return errOpenSubtasks
+	}
+	return nil
+}
+
+// checkBlockerDone is errBlocked when id is done and blocker is open
+func checkBlockerDone(ctx context.Context, q queryer, id, blocker int, lock string) error {
+	var breaks bool
+	err := q.QueryRowContext(ctx, `SELECT t.done AND NOT b.done FROM todos t JOIN todos b ON b.id = $2 WHERE t.id = $1`+lock, id, blocker).Scan(&breaks)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if breaks {
+		return errBlocked
+	}
+	return nil
+}
+
+// inWorkspace returns missing unless todo id is in the workspace of ctx
+func inWorkspace(ctx context.Context, q queryer, id int, missing error) error {
+	var found bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND workspace = $2)`, id, workspaceOf(ctx)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return missing
+	}
+	return nil
+}
+
+// lookupProject looks up (or creates) the project called name, an empty name is no project at all
+func lookupProject(ctx context.Context, q queryer, name string) (sql.NullInt64, error) {
+	if name == "" {
+		return sql.NullInt64{}, nil
+	}
+	id, err := upsertName(ctx, q, "projects", name)
+	return sql.NullInt64{Int64: id, Valid: err == nil}, err
+}
+
+// replaceTags makes tags the complete set of tags on todo id
+func replaceTags(ctx context.Context, q queryer, id int, tags []string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM todo_tags WHERE todo_id = $1`, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tagID, err := upsertName(ctx, q, "tags", tag)
+		if err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `INSERT INTO todo_tags (todo_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertName returns the id of the row called name in a (id, name) lookup table like projects or tags,
+// creating it first if needed. table is never user input.
+func upsertName(ctx context.Context, q queryer, table, name string) (int64, error) {
+	var id int64
+	query := fmt.Sprintf(`INSERT INTO %s (name) VALUES ($1) ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id`, table)
+	err := q.QueryRowContext(ctx, query, name).Scan(&id)
+	return id, err
+}
+
+// referenceError turns a foreign key violation into errUnknownReference
+func referenceError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return errUnknownReference
+	}
+	return err
+}
+
+func expectOneRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// scanner is the bit that *sql.Row and *sql.Rows have in common
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func queryTodos(ctx context.Context, q queryer, query string, args ...any) ([]todo, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []todo
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// scanTodo reads a row of selectTodos, every query that returns todos goes through it
+func scanTodo(row scanner) (todo, error) {
+	r, err := postgresTodoColumns.scan(row)
+	if err != nil {
+		return todo{}, err
+	}
+	t := r.todo
+	t.duedate = r.nullDuedate.Time
+	for _, id := range r.blockers {
+		t.blockedBy = append(t.blockedBy, int(id))
+	}
+
+	// the rule was validated on the way in, so a parse error here means someone edited the row by hand
+	if t.recurrence, err = parseRecurrence(r.rawRecurrence.String); err != nil {
+		return todo{}, fmt.Errorf("todo %d: %w", t.id, err)
+	}
+	return t, nil
+}
+
+// nullTime stores the zero time as NULL, since duedate is optional
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
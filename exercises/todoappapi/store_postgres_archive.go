@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Export reads inside a repeatable read transaction, so the todos and reminders are one snapshot
+// however long writing them out takes. Like every other method it only sees one workspace.
+func (s *postgresStore) Export(ctx context.Context, todo func(storedTodo) error, reminder func(sentReminder) error) error {
+	tx, err := s.begin(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	times, err := todoTimestamps(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, listQuery(nil), workspaceOf(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return err
+		}
+		st := times[t.id]
+		st.todo = t
+		if err := todo(st); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+SELECT r.todo_id, r.kind, r.duedate, r.sent_at
+FROM todo_reminders r JOIN todos t ON t.id = r.todo_id
+WHERE t.workspace = $1
+ORDER BY r.todo_id, r.sent_at`, workspaceOf(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r sentReminder
+		if err := rows.Scan(&r.todo, &r.kind, &r.duedate, &r.sentAt); err != nil {
+			return err
+		}
+		if err := reminder(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// todoTimestamps reads created_at and done_at of every todo in the workspace, by id
+func todoTimestamps(ctx context.Context, q queryer) (map[int]storedTodo, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, created_at, done_at FROM todos WHERE workspace = $1`, workspaceOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := map[int]storedTodo{}
+	for rows.Next() {
+		var (
+			id     int
+			st     storedTodo
+			doneAt sql.NullTime
+		)
+		if err := rows.Scan(&id, &st.createdAt, &doneAt); err != nil {
+			return nil, err
+		}
+		st.doneAt = doneAt.Time
+		times[id] = st
+	}
+	return times, rows.Err()
+}
+
+// Restore inserts every todo with its id first and only then sets parents and blockers, so the
+// order of the archive doesn't matter to the foreign keys. The id sequence is moved past the
+// highest id at the end, or the next Create would collide with a restored todo.
+func (s *postgresStore) Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error {
+	tx, err := s.begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		// todo_tags, todo_blockers and todo_reminders go with the todos through ON DELETE CASCADE
+		if _, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE workspace = $1`, workspaceOf(ctx)); err != nil {
+			return err
+		}
+	} else {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE workspace = $1)`, workspaceOf(ctx)).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errNotEmpty
+		}
+	}
+
+	maxID := 0
+	for _, t := range todos {
+		projectID, err := lookupProject(ctx, tx, t.project)
+		if err != nil {
+			return err
+		}
+		// the insert trigger sets done_at to now for done todos, the archived one goes in after it
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO todos (id, description, done, duedate, priority, recurrence, project_id, created_at, workspace) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			t.id, t.description, t.done, nullTime(t.duedate), t.priority, nullString(t.recurrence.String()), projectID, t.createdAt, workspaceOf(ctx))
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation, the id is in use in another workspace
+			return errIDTaken
+		}
+		if err != nil {
+			return err
+		}
+		maxID = max(maxID, t.id)
+		if t.done {
+			if _, err := tx.ExecContext(ctx, `UPDATE todos SET done_at = $2 WHERE id = $1`, t.id, nullTime(t.doneAt)); err != nil {
+				return err
+			}
+		}
+		if err := replaceTags(ctx, tx, t.id, t.tags); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range todos {
+		if t.parent != 0 {
+			if _, err := tx.ExecContext(ctx, `UPDATE todos SET parent_id = $2 WHERE id = $1`, t.id, t.parent); err != nil {
+				return referenceError(err)
+			}
+		}
+		for _, blocker := range t.blockedBy {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2)`, t.id, blocker); err != nil {
+				return referenceError(err)
+			}
+		}
+	}
+
+	for _, r := range reminders {
+		_, err := tx.ExecContext(ctx, `INSERT INTO todo_reminders (todo_id, kind, duedate, sent_at) VALUES ($1, $2, $3, $4)`,
+			r.todo, string(r.kind), r.duedate, r.sentAt)
+		if err != nil {
+			return referenceError(err)
+		}
+	}
+
+	// only ever forward, other workspaces may be past the restored ids already
+	_, err = tx.ExecContext(ctx, `
+SELECT setval(seq, GREATEST($1, COALESCE(pg_sequence_last_value(seq), 0), 1))
+FROM (SELECT pg_get_serial_sequence('todos', 'id')::regclass AS seq) s`, maxID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
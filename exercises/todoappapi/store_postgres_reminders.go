@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func (s *postgresStore) PendingReminders(ctx context.Context, today, horizon time.Time) ([]reminder, error) {
+	todos, err := queryTodos(ctx, s.db, selectTodos+`
+WHERE NOT t.done AND t.duedate IS NOT NULL AND t.duedate <= $2
+	AND NOT EXISTS (
+		SELECT 1 FROM todo_reminders r
+		WHERE r.todo_id = t.id AND r.duedate = t.duedate
+			AND r.kind = CASE WHEN t.duedate < $1 THEN 'overdue' ELSE 'upcoming' END
+	)
+GROUP BY t.id, p.name ORDER BY t.duedate, t.id`, today, horizon)
+	if err != nil {
+		return nil, err
+	}
+
+	var reminders []reminder
+	for _, t := range todos {
+		reminders = append(reminders, reminder{todo: t, kind: reminderKindFor(t.duedate, today)})
+	}
+	return reminders, nil
+}
+
+func (s *postgresStore) ClaimReminder(ctx context.Context, r reminder) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO todo_reminders (todo_id, kind, duedate) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		r.todo.id, string(r.kind), r.todo.duedate)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *postgresStore) ReleaseReminder(ctx context.Context, r reminder) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM todo_reminders WHERE todo_id = $1 AND kind = $2 AND duedate = $3`,
+		r.todo.id, string(r.kind), r.todo.duedate)
+	return err
+}
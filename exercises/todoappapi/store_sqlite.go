@@ -0,0 +1,619 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteStore is the postgresStore for a single file database. It runs the same queries
+// wherever sqlite allows it. The differences are tags and blockers coming back as json arrays,
+// dates being YYYY-MM-DD text, fts5 instead of tsvector, and no row locks: every transaction
+// is opened with BEGIN IMMEDIATE (see openSQLite), so writers simply take turns.
+type sqliteStore struct {
+	db *preparedDB
+}
+
+func newSQLiteStore(db *sql.DB, pool poolConfig) (*sqliteStore, error) {
+	err := checkSchema(context.Background(), db, sqliteTableColumns, sqliteTodoColumns.columns(), sqliteUnmappedColumns...)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := newPreparedDB(db, pool, sqliteGetTodoQuery, sqliteListQuery(nil), insertTodoQuery)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStore{db: prepared}, nil
+}
+
+// openSQLite opens (or creates) the database file at path and brings its schema up to date
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db, "migrations/sqlite"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+const (
+	sqliteDate      = "2006-01-02"
+	sqliteTimestamp = "2006-01-02T15:04:05.000Z" // what strftime('%Y-%m-%dT%H:%M:%fZ') writes, in UTC
+)
+
+const sqliteTableColumns = `SELECT name FROM pragma_table_info('todos')`
+
+// sqliteUnmappedColumns are the todos columns that aren't read into the model, search is an fts5 table of its own
+var sqliteUnmappedColumns = []string{"created_at", "done_at", "workspace"}
+
+// sqliteTodoRow is a todo the way sqliteSelectTodos reads it: dates as text, tags and blockers as json
+type sqliteTodoRow struct {
+	todo
+	rawDuedate    sql.NullString
+	rawRecurrence sql.NullString
+	rawTags       string
+	rawBlockers   string
+}
+
+var sqliteTodoColumns = rowMapping[sqliteTodoRow]{
+	{"id", "id", "t.id", func(r *sqliteTodoRow) any { return &r.id }},
+	{"description", "description", "t.description", func(r *sqliteTodoRow) any { return &r.description }},
+	{"done", "done", "t.done", func(r *sqliteTodoRow) any { return &r.done }},
+	{"duedate", "duedate", "t.duedate", func(r *sqliteTodoRow) any { return &r.rawDuedate }},
+	{"priority", "priority", "t.priority", func(r *sqliteTodoRow) any { return &r.priority }},
+	{"recurrence", "recurrence", "t.recurrence", func(r *sqliteTodoRow) any { return &r.rawRecurrence }},
+	{"parent", "parent_id", "COALESCE(t.parent_id, 0)", func(r *sqliteTodoRow) any { return &r.parent }},
+	{"project", "project_id", "COALESCE(p.name, '')", func(r *sqliteTodoRow) any { return &r.project }},
+	{"tags", "", `(SELECT json_group_array(name) FROM (
+		SELECT g.name FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id WHERE tt.todo_id = t.id ORDER BY g.name))`,
+		func(r *sqliteTodoRow) any { return &r.rawTags }},
+	{"blockedBy", "", `(SELECT json_group_array(blocked_by_id) FROM (
+		SELECT b.blocked_by_id FROM todo_blockers b WHERE b.todo_id = t.id ORDER BY b.blocked_by_id))`,
+		func(r *sqliteTodoRow) any { return &r.rawBlockers }},
+}
+
+var sqliteSelectTodos = `
+SELECT ` + sqliteTodoColumns.selectList() + `
+FROM todos t
+LEFT JOIN projects p ON p.id = t.project_id`
+
+func (s *sqliteStore) List(ctx context.Context, filter todoFilter) ([]todo, error) {
+	var (
+		where []string
+		args  = []any{workspaceOf(ctx)}
+	)
+	if filter.priority != nil {
+		args = append(args, *filter.priority)
+		where = append(where, fmt.Sprintf("t.priority = $%d", len(args)))
+	}
+	if filter.project != "" {
+		args = append(args, filter.project)
+		where = append(where, fmt.Sprintf("p.name = $%d", len(args)))
+	}
+	if len(filter.tags) > 0 {
+		// the tags go in as one json array, so the query text is the same however many there are
+		tags, err := json.Marshal(filter.tags)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(tags))
+		where = append(where, fmt.Sprintf(`t.id IN (
+	SELECT tt.todo_id FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id
+	WHERE g.name IN (SELECT value FROM json_each($%[1]d))
+	GROUP BY tt.todo_id HAVING count(*) = (SELECT count(DISTINCT value) FROM json_each($%[1]d)))`, len(args)))
+	}
+
+	return sqliteQueryTodos(ctx, s.db, sqliteListQuery(where), args...)
+}
+
+// sqliteListQuery is listQuery for sqlite
+func sqliteListQuery(where []string) string {
+	query := sqliteSelectTodos + "\nWHERE " + strings.Join(append([]string{"t.workspace = $1"}, where...), " AND ")
+	return query + "\nORDER BY t.id"
+}
+
+func (s *sqliteStore) Get(ctx context.Context, id int) (todo, error) {
+	return sqliteGetTodo(ctx, s.db, id)
+}
+
+func (s *sqliteStore) Create(ctx context.Context, t todo) (todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return todo{}, err
+	}
+	defer tx.Rollback()
+
+	if t, err = sqliteInsertTodo(ctx, tx, t); err != nil {
+		return todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+func (s *sqliteStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]todo, len(todos))
+	for i, t := range todos {
+		if created[i], err = sqliteInsertTodo(ctx, tx, t); err != nil {
+			return nil, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+func (s *sqliteStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	defer tx.Rollback()
+
+	var wasDone bool
+	err = tx.QueryRowContext(ctx, `SELECT done FROM todos WHERE id = $1 AND workspace = $2`, t.id, workspaceOf(ctx)).Scan(&wasDone)
+	if err == sql.ErrNoRows {
+		return todo{}, nil, errNotFound
+	}
+	if err != nil {
+		return todo{}, nil, err
+	}
+	completing := t.done && !wasDone
+	if completing {
+		if err := checkCompletable(ctx, tx, t.id); err != nil {
+			return todo{}, nil, err
+		}
+	}
+	if !t.done && wasDone {
+		if err := checkReopenable(ctx, tx, t.id, ""); err != nil {
+			return todo{}, nil, err
+		}
+	}
+
+	projectID, err := lookupProject(ctx, tx, t.project)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE todos SET description = $2, done = $3, duedate = $4, priority = $5, recurrence = $6, project_id = $7 WHERE id = $1`,
+		t.id, t.description, t.done, sqliteNullDate(t.duedate), t.priority, nullString(t.recurrence.String()), projectID)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	if err := replaceTags(ctx, tx, t.id, t.tags); err != nil {
+		return todo{}, nil, err
+	}
+
+	if t, err = sqliteGetTodo(ctx, tx, t.id); err != nil {
+		return todo{}, nil, err
+	}
+	var next *todo
+	if n, ok := t.nextOccurrence(time.Now()); completing && ok {
+		if n, err = sqliteInsertTodo(ctx, tx, n); err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return t, next, tx.Commit()
+}
+
+func (s *sqliteStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasSubtasks bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1) FROM todos WHERE id = $1 AND workspace = $2`, id, workspaceOf(ctx)).Scan(&hasSubtasks)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if hasSubtasks {
+		return errHasSubtasks
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	defer tx.Rollback()
+
+	t, err := sqliteGetTodo(ctx, tx, id)
+	if err != nil {
+		return todo{}, nil, err
+	}
+	if t.done {
+		return t, nil, tx.Commit()
+	}
+
+	if err := checkCompletable(ctx, tx, id); err != nil {
+		return todo{}, nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE todos SET done = true WHERE id = $1`, id); err != nil {
+		return todo{}, nil, err
+	}
+	t.done = true
+
+	var next *todo
+	if n, ok := t.nextOccurrence(time.Now()); ok {
+		if n, err = sqliteInsertTodo(ctx, tx, n); err != nil {
+			return todo{}, nil, err
+		}
+		next = &n
+	}
+	return t, next, tx.Commit()
+}
+
+func (s *sqliteStore) Tree(ctx context.Context, id int) (todo, error) {
+	todos, err := sqliteQueryTodos(ctx, s.db, `
+WITH RECURSIVE tree (id) AS (
+	SELECT id FROM todos WHERE id = $1 AND workspace = $2
+	UNION
+	SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id
+)`+sqliteSelectTodos+`
+WHERE t.id IN (SELECT id FROM tree) ORDER BY t.id`, id, workspaceOf(ctx))
+	if err != nil {
+		return todo{}, err
+	}
+	return nestSubtasks(id, todos)
+}
+
+func (s *sqliteStore) SetParent(ctx context.Context, id, parent int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	if parent != 0 {
+		if err := inWorkspace(ctx, tx, parent, errUnknownReference); err != nil {
+			return err
+		}
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `
+WITH RECURSIVE ancestors (id) AS (
+	SELECT $2
+	UNION
+	SELECT t.parent_id FROM todos t JOIN ancestors a ON t.id = a.id WHERE t.parent_id IS NOT NULL
+)
+SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)`, id, parent).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errCycle
+		}
+		if err := checkParentDone(ctx, tx, id, parent, ""); err != nil {
+			return err
+		}
+		parentID = sql.NullInt64{Int64: int64(parent), Valid: true}
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE todos SET parent_id = $2 WHERE id = $1 AND workspace = $3`, id, parentID, workspaceOf(ctx))
+	if err != nil {
+		return sqliteReferenceError(err)
+	}
+	if err := expectOneRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	if id == blocker {
+		return errCycle
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := sqliteGetTodo(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := inWorkspace(ctx, tx, blocker, errUnknownReference); err != nil {
+		return err
+	}
+
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `
+WITH RECURSIVE chain (id) AS (
+	SELECT $2
+	UNION
+	SELECT b.blocked_by_id FROM todo_blockers b JOIN chain c ON b.todo_id = c.id
+)
+SELECT EXISTS (SELECT 1 FROM chain WHERE id = $1)`, id, blocker).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return errCycle
+	}
+	if err := checkBlockerDone(ctx, tx, id, blocker, ""); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, blocker)
+	if err != nil {
+		return sqliteReferenceError(err)
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	_, err := s.db.ExecContext(ctx, `
+DELETE FROM todo_blockers
+WHERE todo_id = $1 AND blocked_by_id = $2 AND todo_id IN (SELECT id FROM todos WHERE workspace = $3)`,
+		id, blocker, workspaceOf(ctx))
+	return err
+}
+
+// Search goes through the fts5 table. Every word of the query becomes a quoted prefix term,
+// which keeps fts5's own query syntax out of reach of whatever people type.
+func (s *sqliteStore) Search(ctx context.Context, query string, limit int) ([]searchResult, error) {
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = `"` + token + `"*`
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT rowid, -bm25(todos_fts), highlight(todos_fts, 0, '`+highlightStart+`', '`+highlightStop+`')
+FROM todos_fts
+WHERE todos_fts MATCH $1 AND rowid IN (SELECT id FROM todos WHERE workspace = $3)
+ORDER BY bm25(todos_fts), rowid
+LIMIT $2`, strings.Join(terms, " "), limit, workspaceOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []searchResult
+	for rows.Next() {
+		var res searchResult
+		if err := rows.Scan(&res.Todo.id, &res.Rank, &res.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	found := results[:0]
+	for _, res := range results {
+		t, err := s.Get(ctx, res.Todo.id)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Todo = t
+		found = append(found, res)
+	}
+	return found, nil
+}
+
+// Stats runs the same two aggregations as postgres. julianday does the timestamp arithmetic and
+// date(..., 'weekday 0', '-6 days') finds the Monday, weeks end on the Sunday weekday 0 moves to.
+func (s *sqliteStore) Stats(ctx context.Context, today, since time.Time) (todoStats, error) {
+	var (
+		stats todoStats
+		avg   sql.NullFloat64
+	)
+	err := s.db.QueryRowContext(ctx, `
+SELECT count(*),
+	COALESCE(sum(NOT done), 0),
+	COALESCE(sum(done), 0),
+	COALESCE(sum(NOT done AND duedate < $1), 0),
+	avg((julianday(done_at) - julianday(created_at)) * 86400)
+FROM todos
+WHERE workspace = $2`, today.Format(sqliteDate), workspaceOf(ctx)).Scan(&stats.Total, &stats.Open, &stats.Done, &stats.Overdue, &avg)
+	if err != nil {
+		return todoStats{}, err
+	}
+	if avg.Valid {
+		stats.AverageSecondsToDone = &avg.Float64
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT date(done_at, 'weekday 0', '-6 days'), count(*)
+FROM todos
+WHERE done_at >= $1 AND workspace = $2
+GROUP BY 1`, since.UTC().Format(sqliteTimestamp), workspaceOf(ctx))
+	if err != nil {
+		return todoStats{}, err
+	}
+	defer rows.Close()
+
+	completed := map[string]int{}
+	for rows.Next() {
+		var (
+			week string
+			n    int
+		)
+		if err := rows.Scan(&week, &n); err != nil {
+			return todoStats{}, err
+		}
+		completed[week] = n
+	}
+	if err := rows.Err(); err != nil {
+		return todoStats{}, err
+	}
+	stats.CompletedByWeek = completionTrend(since, today, completed)
+	return stats, nil
+}
+
+func (s *sqliteStore) PendingReminders(ctx context.Context, today, horizon time.Time) ([]reminder, error) {
+	todos, err := sqliteQueryTodos(ctx, s.db, sqliteSelectTodos+`
+WHERE NOT t.done AND t.duedate IS NOT NULL AND t.duedate <= $2
+	AND NOT EXISTS (
+		SELECT 1 FROM todo_reminders r
+		WHERE r.todo_id = t.id AND r.duedate = t.duedate
+			AND r.kind = CASE WHEN t.duedate < $1 THEN 'overdue' ELSE 'upcoming' END
+	)
+ORDER BY t.duedate, t.id`, today.Format(sqliteDate), horizon.Format(sqliteDate))
+	if err != nil {
+		return nil, err
+	}
+
+	reminders := make([]reminder, len(todos))
+	for i, t := range todos {
+		reminders[i] = reminder{todo: t, kind: reminderKindFor(t.duedate, today)}
+	}
+	return reminders, nil
+}
+
+func (s *sqliteStore) ClaimReminder(ctx context.Context, r reminder) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO todo_reminders (todo_id, kind, duedate) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		r.todo.id, string(r.kind), r.todo.duedate.Format(sqliteDate))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *sqliteStore) ReleaseReminder(ctx context.Context, r reminder) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM todo_reminders WHERE todo_id = $1 AND kind = $2 AND duedate = $3`,
+		r.todo.id, string(r.kind), r.todo.duedate.Format(sqliteDate))
+	return err
+}
+
+func sqliteQueryTodos(ctx context.Context, q queryer, query string, args ...any) ([]todo, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []todo
+	for rows.Next() {
+		t, err := sqliteScanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+var sqliteGetTodoQuery = sqliteSelectTodos + "\nWHERE t.id = $1 AND t.workspace = $2"
+
+func sqliteGetTodo(ctx context.Context, q queryer, id int) (todo, error) {
+	t, err := sqliteScanTodo(q.QueryRowContext(ctx, sqliteGetTodoQuery, id, workspaceOf(ctx)))
+	if err == sql.ErrNoRows {
+		return todo{}, errNotFound
+	}
+	return t, err
+}
+
+func sqliteInsertTodo(ctx context.Context, q queryer, t todo) (todo, error) {
+	if err := checkReferences(ctx, q, t, ""); err != nil {
+		return todo{}, err
+	}
+	projectID, err := lookupProject(ctx, q, t.project)
+	if err != nil {
+		return todo{}, err
+	}
+
+	var parentID sql.NullInt64
+	if t.parent != 0 {
+		parentID = sql.NullInt64{Int64: int64(t.parent), Valid: true}
+	}
+
+	err = q.QueryRowContext(ctx, insertTodoQuery,
+		t.description, t.done, sqliteNullDate(t.duedate), t.priority, nullString(t.recurrence.String()), parentID, projectID, workspaceOf(ctx),
+	).Scan(&t.id)
+	if err != nil {
+		return todo{}, sqliteReferenceError(err)
+	}
+
+	for _, blocker := range t.blockedBy {
+		if _, err := q.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, t.id, blocker); err != nil {
+			return todo{}, sqliteReferenceError(err)
+		}
+	}
+	if err := replaceTags(ctx, q, t.id, t.tags); err != nil {
+		return todo{}, err
+	}
+	return t, nil
+}
+
+// sqliteScanTodo is scanTodo for rows of sqliteSelectTodos
+func sqliteScanTodo(row scanner) (todo, error) {
+	r, err := sqliteTodoColumns.scan(row)
+	if err != nil {
+		return todo{}, err
+	}
+	t := r.todo
+
+	if r.rawDuedate.Valid {
+		d, err := time.Parse(sqliteDate, r.rawDuedate.String)
+		if err != nil {
+			return todo{}, fmt.Errorf("todo %d: %w", t.id, err)
+		}
+		t.duedate = d
+	}
+	if err := json.Unmarshal([]byte(r.rawTags), &t.tags); err != nil {
+		return todo{}, err
+	}
+	if err := json.Unmarshal([]byte(r.rawBlockers), &t.blockedBy); err != nil {
+		return todo{}, err
+	}
+
+	if t.recurrence, err = parseRecurrence(r.rawRecurrence.String); err != nil {
+		return todo{}, fmt.Errorf("todo %d: %w", t.id, err)
+	}
+	return t, nil
+}
+
+// sqliteNullDate is nullTime for the YYYY-MM-DD text sqlite keeps dates in
+func sqliteNullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(sqliteDate)
+}
+
+// sqliteReferenceError is referenceError for sqlite's foreign key violations
+func sqliteReferenceError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+		return errUnknownReference
+	}
+	return err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Export is postgresStore.Export for sqlite. A read only transaction is a plain deferred BEGIN
+// instead of the BEGIN IMMEDIATE the other ones are, so it takes no write lock. With the file in
+// WAL mode it still sees one state of the file, and writers carry on while the export streams.
+func (s *sqliteStore) Export(ctx context.Context, todo func(storedTodo) error, reminder func(sentReminder) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	times := map[int]storedTodo{}
+	rows, err := tx.QueryContext(ctx, `SELECT id, created_at, done_at FROM todos WHERE workspace = $1`, workspaceOf(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id              int
+			created, doneAt sql.NullString
+			st              storedTodo
+		)
+		if err := rows.Scan(&id, &created, &doneAt); err != nil {
+			return err
+		}
+		if st.createdAt, err = sqliteNullTimestamp(created); err != nil {
+			return err
+		}
+		if st.doneAt, err = sqliteNullTimestamp(doneAt); err != nil {
+			return err
+		}
+		times[id] = st
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, sqliteListQuery(nil), workspaceOf(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := sqliteScanTodo(rows)
+		if err != nil {
+			return err
+		}
+		st := times[t.id]
+		st.todo = t
+		if err := todo(st); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+SELECT r.todo_id, r.kind, r.duedate, r.sent_at
+FROM todo_reminders r JOIN todos t ON t.id = r.todo_id
+WHERE t.workspace = $1
+ORDER BY r.todo_id, r.sent_at`, workspaceOf(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r               sentReminder
+			duedate, sentAt string
+		)
+		if err := rows.Scan(&r.todo, &r.kind, &duedate, &sentAt); err != nil {
+			return err
+		}
+		if r.duedate, err = time.Parse(sqliteDate, duedate); err != nil {
+			return err
+		}
+		// sent_at defaults to CURRENT_TIMESTAMP, which is "YYYY-MM-DD HH:MM:SS" in UTC
+		if r.sentAt, err = time.Parse(time.DateTime, sentAt); err != nil {
+			return err
+		}
+		if err := reminder(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sqliteNullTimestamp reads what strftime('%Y-%m-%dT%H:%M:%fZ') wrote, NULL is the zero time
+func sqliteNullTimestamp(s sql.NullString) (time.Time, error) {
+	if !s.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s.String)
+}
+
+// Restore is postgresStore.Restore for sqlite. The AUTOINCREMENT counter follows explicit ids
+// on its own, so there is no sequence to move.
+func (s *sqliteStore) Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE workspace = $1`, workspaceOf(ctx)); err != nil {
+			return err
+		}
+	} else {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM todos WHERE workspace = $1)`, workspaceOf(ctx)).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return errNotEmpty
+		}
+	}
+
+	for _, t := range todos {
+		projectID, err := lookupProject(ctx, tx, t.project)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO todos (id, description, done, duedate, priority, recurrence, project_id, workspace) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			t.id, t.description, t.done, sqliteNullDate(t.duedate), t.priority, nullString(t.recurrence.String()), projectID, workspaceOf(ctx))
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY { // the id is in use in another workspace
+			return errIDTaken
+		}
+		if err != nil {
+			return err
+		}
+		// the insert trigger stamped both with the current time
+		_, err = tx.ExecContext(ctx, `UPDATE todos SET created_at = $2, done_at = $3 WHERE id = $1`,
+			t.id, t.createdAt.UTC().Format(sqliteTimestamp), sqliteNullTimestampArg(t.doneAt))
+		if err != nil {
+			return err
+		}
+		if err := replaceTags(ctx, tx, t.id, t.tags); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range todos {
+		if t.parent != 0 {
+			if _, err := tx.ExecContext(ctx, `UPDATE todos SET parent_id = $2 WHERE id = $1`, t.id, t.parent); err != nil {
+				return sqliteReferenceError(err)
+			}
+		}
+		for _, blocker := range t.blockedBy {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocked_by_id) VALUES ($1, $2)`, t.id, blocker); err != nil {
+				return sqliteReferenceError(err)
+			}
+		}
+	}
+
+	for _, r := range reminders {
+		_, err := tx.ExecContext(ctx, `INSERT INTO todo_reminders (todo_id, kind, duedate, sent_at) VALUES ($1, $2, $3, $4)`,
+			r.todo, string(r.kind), r.duedate.Format(sqliteDate), r.sentAt.UTC().Format(time.DateTime))
+		if err != nil {
+			return sqliteReferenceError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func sqliteNullTimestampArg(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimestamp)
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forEachStore runs test against a fresh store of every kind. The postgres ones only run with
+// TODOAPP_TEST_POSTGRES set to the connection string of a database the tests are free to wipe:
+//
+//	TODOAPP_TEST_POSTGRES="host=localhost user=postgres password=gopwd dbname=postgres sslmode=disable" go test ./...
+func forEachStore(t *testing.T, test func(t *testing.T, s todoStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, openTestSQLite(t))
+	})
+	for _, rls := range []bool{false, true} {
+		name := "postgres"
+		if rls {
+			name = "postgres-rls"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, err := newPostgresStore(openTestPostgres(t), testPool, rls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test(t, s)
+		})
+	}
+}
+
+var testPool = poolConfig{maxOpenConns: 4, maxIdleConns: 4}
+
+func openTestSQLite(t testing.TB) *sqliteStore {
+	t.Helper()
+	db, err := openSQLite(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := newSQLiteStore(db, testPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// openTestPostgres empties the public schema and migrates it from scratch
+func openTestPostgres(t testing.TB) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TODOAPP_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("TODOAPP_TEST_POSTGRES is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db, "migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func mustCreate(t *testing.T, ctx context.Context, s todoStore, td todo) todo {
+	t.Helper()
+	created, err := s.Create(ctx, td)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", td.description, err)
+	}
+	return created
+}
+
+func mustComplete(t *testing.T, ctx context.Context, s todoStore, id int) {
+	t.Helper()
+	if _, _, err := s.Complete(ctx, id); err != nil {
+		t.Fatalf("Complete(%d): %v", id, err)
+	}
+}
+
+func expectErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got %v, want %v", what, err, want)
+	}
+}
+
+func TestStoreCycles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := context.Background()
+		a := mustCreate(t, ctx, s, todo{description: "a"})
+		b := mustCreate(t, ctx, s, todo{description: "b"})
+		c := mustCreate(t, ctx, s, todo{description: "c"})
+
+		expectErr(t, "SetParent onto itself", s.SetParent(ctx, a.id, a.id), errCycle)
+		expectErr(t, "SetParent b under a", s.SetParent(ctx, b.id, a.id), nil)
+		expectErr(t, "SetParent c under b", s.SetParent(ctx, c.id, b.id), nil)
+		expectErr(t, "SetParent a under its grandchild", s.SetParent(ctx, a.id, c.id), errCycle)
+		expectErr(t, "SetParent onto a missing todo", s.SetParent(ctx, a.id, c.id+100), errUnknownReference)
+
+		expectErr(t, "AddBlocker on itself", s.AddBlocker(ctx, a.id, a.id), errCycle)
+		expectErr(t, "a blocked by b", s.AddBlocker(ctx, a.id, b.id), nil)
+		expectErr(t, "b blocked by c", s.AddBlocker(ctx, b.id, c.id), nil)
+		expectErr(t, "c blocked by a", s.AddBlocker(ctx, c.id, a.id), errCycle)
+		expectErr(t, "AddBlocker of a missing todo", s.AddBlocker(ctx, a.id, c.id+100), errUnknownReference)
+
+		got, err := s.Get(ctx, a.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.blockedBy) != 1 || got.blockedBy[0] != b.id || got.parent != 0 {
+			t.Errorf("a ended up with parent %d and blockers %v", got.parent, got.blockedBy)
+		}
+	})
+}
+
+func TestStoreDoneRules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := context.Background()
+		open := mustCreate(t, ctx, s, todo{description: "open"})
+		done := mustCreate(t, ctx, s, todo{description: "done"})
+		mustComplete(t, ctx, s, done.id)
+
+		_, err := s.Create(ctx, todo{description: "done but blocked", done: true, blockedBy: []int{open.id}})
+		expectErr(t, "Create a done todo behind an open one", err, errBlocked)
+		_, err = s.Create(ctx, todo{description: "open under done", parent: done.id})
+		expectErr(t, "Create an open todo under a done one", err, errOpenSubtasks)
+		mustCreate(t, ctx, s, todo{description: "done behind done", done: true, blockedBy: []int{done.id}})
+		mustCreate(t, ctx, s, todo{description: "done under done", done: true, parent: done.id})
+
+		expectErr(t, "SetParent of an open todo onto a done one", s.SetParent(ctx, open.id, done.id), errOpenSubtasks)
+		expectErr(t, "AddBlocker of an open todo to a done one", s.AddBlocker(ctx, done.id, open.id), errBlocked)
+
+		parent := mustCreate(t, ctx, s, todo{description: "parent"})
+		mustCreate(t, ctx, s, todo{description: "child", parent: parent.id})
+		_, _, err = s.Complete(ctx, parent.id)
+		expectErr(t, "Complete with an open subtask", err, errOpenSubtasks)
+
+		blocked := mustCreate(t, ctx, s, todo{description: "blocked", blockedBy: []int{open.id}})
+		_, _, err = s.Complete(ctx, blocked.id)
+		expectErr(t, "Complete while blocked", err, errBlocked)
+		mustComplete(t, ctx, s, open.id)
+		mustComplete(t, ctx, s, blocked.id)
+
+		reopen := func(what string, td todo, want error) {
+			t.Helper()
+			td, err := s.Get(ctx, td.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			td.done = false
+			_, _, err = s.Update(ctx, td)
+			expectErr(t, what, err, want)
+			if got, _ := s.Get(ctx, td.id); got.done == (want == nil) {
+				t.Errorf("%s: done is %v afterwards", what, got.done)
+			}
+		}
+		doneChild := mustCreate(t, ctx, s, todo{description: "done child", done: true, parent: done.id})
+		reopen("reopen a subtask of a done todo", doneChild, errOpenSubtasks)
+		reopen("reopen what a done todo waits for", open, errBlocked)
+		reopen("reopen the done todo first", blocked, nil)
+		reopen("then what it waited for", open, nil)
+	})
+}
+
+func TestStoreDeleteWithSubtasks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := context.Background()
+		parent := mustCreate(t, ctx, s, todo{description: "parent"})
+		child := mustCreate(t, ctx, s, todo{description: "child", parent: parent.id})
+
+		expectErr(t, "Delete with a subtask", s.Delete(ctx, parent.id), errHasSubtasks)
+		if _, err := s.Get(ctx, child.id); err != nil {
+			t.Errorf("the subtask is gone after a refused Delete: %v", err)
+		}
+
+		expectErr(t, "Delete the subtask", s.Delete(ctx, child.id), nil)
+		expectErr(t, "Delete the parent", s.Delete(ctx, parent.id), nil)
+		expectErr(t, "Delete it again", s.Delete(ctx, parent.id), errNotFound)
+		_, err := s.Get(ctx, parent.id)
+		expectErr(t, "Get after Delete", err, errNotFound)
+	})
+}
+
+func TestStoreUpdateCompletes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := context.Background()
+		blocker := mustCreate(t, ctx, s, todo{description: "blocker"})
+		blocked := mustCreate(t, ctx, s, todo{description: "blocked", blockedBy: []int{blocker.id}})
+
+		blocked.description, blocked.done = "renamed", true
+		_, _, err := s.Update(ctx, blocked)
+		expectErr(t, "Update to done while blocked", err, errBlocked)
+		if got, _ := s.Get(ctx, blocked.id); got.description != "blocked" || got.done {
+			t.Errorf("a refused Update left %q, done %v", got.description, got.done)
+		}
+
+		rule, _ := parseRecurrence("weekly")
+		weekly := mustCreate(t, ctx, s, todo{description: "water the plants", duedate: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)})
+		weekly.done, weekly.recurrence = true, rule
+		updated, next, err := s.Update(ctx, weekly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated.done || next == nil || next.done || !next.duedate.Equal(time.Date(2026, 5, 8, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Update to done gave %+v and next %+v", updated, next)
+		}
+		if _, next, _ = s.Update(ctx, updated); next != nil {
+			t.Errorf("an Update of a todo that was done already made another occurrence %+v", next)
+		}
+	})
+}
+
+func TestStoreListFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := withWorkspace(t.Context(), "filters")
+		both := mustCreate(t, ctx, s, todo{description: "both", tags: []string{"home", "urgent"}, priority: priorityHigh, project: "house"})
+		home := mustCreate(t, ctx, s, todo{description: "home", tags: []string{"home"}, priority: priorityLow, project: "house"})
+		urgent := mustCreate(t, ctx, s, todo{description: "urgent", tags: []string{"urgent"}, priority: priorityHigh})
+		plain := mustCreate(t, ctx, s, todo{description: "plain"})
+
+		prio := func(p priority) *priority { return &p }
+		tests := []struct {
+			filter todoFilter
+			want   []int
+		}{
+			{todoFilter{}, []int{both.id, home.id, urgent.id, plain.id}},
+			{todoFilter{tags: []string{"home"}}, []int{both.id, home.id}},
+			{todoFilter{tags: []string{"home", "urgent"}}, []int{both.id}},
+			{todoFilter{tags: []string{"home", "home"}}, []int{both.id, home.id}},
+			{todoFilter{tags: []string{"home", "garden"}}, nil},
+			{todoFilter{priority: prio(priorityHigh)}, []int{both.id, urgent.id}},
+			{todoFilter{priority: prio(priorityNone)}, []int{plain.id}},
+			{todoFilter{priority: prio(priorityMedium)}, nil},
+			{todoFilter{project: "house"}, []int{both.id, home.id}},
+			{todoFilter{project: "garden"}, nil},
+			{todoFilter{priority: prio(priorityHigh), project: "house", tags: []string{"urgent"}}, []int{both.id}},
+			{todoFilter{priority: prio(priorityLow), tags: []string{"urgent"}}, nil},
+		}
+		for _, tt := range tests {
+			todos, err := s.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, td := range todos {
+				got = append(got, td.id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("List(%s): %v, want %v", tt.filter.cacheKey(), got, tt.want)
+			}
+		}
+	})
+}
+
+// Nothing a workspace does with the ids of another one may see or change its todos
+func TestStoreWorkspacesAreSeparate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		alpha := withWorkspace(context.Background(), "alpha")
+		beta := withWorkspace(context.Background(), "beta")
+		mine := mustCreate(t, alpha, s, todo{description: "mine", tags: []string{"shared"}})
+		theirs := mustCreate(t, beta, s, todo{description: "theirs", tags: []string{"shared"}})
+		theirChild := mustCreate(t, beta, s, todo{description: "their child", parent: theirs.id})
+
+		_, err := s.Get(alpha, theirs.id)
+		expectErr(t, "Get", err, errNotFound)
+		_, err = s.Tree(alpha, theirs.id)
+		expectErr(t, "Tree", err, errNotFound)
+		for _, filter := range []todoFilter{{}, {tags: []string{"shared"}}} {
+			todos, err := s.List(alpha, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(todos) != 1 || todos[0].id != mine.id {
+				t.Errorf("List(%+v) in alpha: %+v, want only %d", filter, todos, mine.id)
+			}
+		}
+
+		theirs.description = "taken over"
+		_, _, err = s.Update(alpha, theirs)
+		expectErr(t, "Update", err, errNotFound)
+		_, _, err = s.Complete(alpha, theirs.id)
+		expectErr(t, "Complete", err, errNotFound)
+		expectErr(t, "Delete", s.Delete(alpha, theirChild.id), errNotFound)
+
+		expectErr(t, "SetParent of their todo", s.SetParent(alpha, theirChild.id, mine.id), errNotFound)
+		expectErr(t, "SetParent under their todo", s.SetParent(alpha, mine.id, theirs.id), errUnknownReference)
+		_, err = s.Create(alpha, todo{description: "under theirs", parent: theirs.id})
+		expectErr(t, "Create under their todo", err, errUnknownReference)
+		expectErr(t, "AddBlocker to their todo", s.AddBlocker(alpha, theirs.id, mine.id), errNotFound)
+		expectErr(t, "AddBlocker of their todo", s.AddBlocker(alpha, mine.id, theirs.id), errUnknownReference)
+
+		var exported []storedTodo
+		err = s.Export(alpha, func(st storedTodo) error { exported = append(exported, st); return nil }, func(sentReminder) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(exported) != 1 || exported[0].id != mine.id {
+			t.Errorf("Export of alpha: %+v, want only %d", exported, mine.id)
+		}
+
+		// their todos with their ids can't be restored into alpha, and replacing alpha leaves them be
+		expectErr(t, "Restore their ids", s.Restore(alpha, []storedTodo{{todo: theirs, createdAt: time.Now()}}, nil, true), errIDTaken)
+		expectErr(t, "Restore with replace", s.Restore(alpha, nil, nil, true), nil)
+
+		for _, td := range []todo{theirs, theirChild} {
+			got, err := s.Get(beta, td.id)
+			if err != nil {
+				t.Fatalf("beta lost %d: %v", td.id, err)
+			}
+			if got.description == "taken over" || got.done || len(got.blockedBy) != 0 {
+				t.Errorf("alpha changed beta's %d: %+v", td.id, got)
+			}
+		}
+		if got, _ := s.Get(beta, theirChild.id); got.parent != theirs.id {
+			t.Errorf("alpha moved beta's subtask under %d", got.parent)
+		}
+	})
+}
+
+func TestStoreImportIsAllOrNothing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := withWorkspace(t.Context(), "imports")
+		_, err := s.Import(ctx, []todo{{description: "fine"}, {description: "under nothing", parent: 1 << 30}})
+		expectErr(t, "Import with an unknown parent", err, errUnknownReference)
+		todos, err := s.List(ctx, todoFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(todos) != 0 {
+			t.Errorf("a failed Import left %d todos", len(todos))
+		}
+		if _, err := s.Import(ctx, []todo{{description: "a"}, {description: "b"}}); err != nil {
+			t.Fatal(err)
+		}
+		if todos, _ := s.List(ctx, todoFilter{}); !slices.EqualFunc(todos, []string{"a", "b"}, func(td todo, d string) bool { return td.description == d }) {
+			t.Errorf("Import gave %+v", todos)
+		}
+	})
+}
+
+func TestStoreStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		ctx := withWorkspace(t.Context(), "stats")
+		day := func(d string) time.Time {
+			t, _ := time.Parse(time.RFC3339, d)
+			return t
+		}
+		// restored, so the creation and completion times are the test's to pick
+		err := s.Restore(ctx, []storedTodo{
+			{todo: todo{id: 101, description: "overdue", duedate: day("2026-10-20T00:00:00Z")}, createdAt: day("2026-10-01T00:00:00Z")},
+			{todo: todo{id: 102, description: "due today", duedate: day("2026-10-21T00:00:00Z")}, createdAt: day("2026-10-01T00:00:00Z")},
+			{todo: todo{id: 103, description: "no duedate"}, createdAt: day("2026-10-01T00:00:00Z")},
+			{todo: todo{id: 104, description: "done on a sunday", done: true}, createdAt: day("2026-10-01T00:00:00Z"), doneAt: day("2026-10-11T12:00:00Z")},
+			{todo: todo{id: 105, description: "done on a monday", done: true}, createdAt: day("2026-10-19T00:00:00Z"), doneAt: day("2026-10-19T06:00:00Z")},
+			{todo: todo{id: 106, description: "done before the weeks", done: true}, createdAt: day("2026-09-01T00:00:00Z"), doneAt: day("2026-09-20T00:00:00Z")},
+			{todo: todo{id: 107, description: "done before the timestamps", done: true}, createdAt: day("2026-09-01T00:00:00Z")},
+		}, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		today := day("2026-10-21T00:00:00Z") // a wednesday
+		got, err := s.Stats(ctx, today, weekStart(today).AddDate(0, 0, -7*3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Total != 7 || got.Open != 3 || got.Done != 4 || got.Overdue != 1 {
+			t.Errorf("got total %d, open %d, done %d, overdue %d, want 7, 3, 4, 1", got.Total, got.Open, got.Done, got.Overdue)
+		}
+		weeks := []weekCount{{"2026-09-28", 0}, {"2026-10-05", 1}, {"2026-10-12", 0}, {"2026-10-19", 1}}
+		if !slices.Equal(got.CompletedByWeek, weeks) {
+			t.Errorf("completed by week %v, want %v", got.CompletedByWeek, weeks)
+		}
+		// 10.5 days, 6 hours and 19 days, 107 has no completion time
+		want := (10.5 + 0.25 + 19) * 86400 / 3
+		if avg := got.AverageSecondsToDone; avg == nil || math.Abs(*avg-want) > 1 {
+			t.Errorf("average seconds to done %v, want %v", avg, want)
+		}
+
+		empty, err := s.Stats(withWorkspace(t.Context(), "nothing"), today, weekStart(today))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if empty.Total != 0 || empty.AverageSecondsToDone != nil || !slices.Equal(empty.CompletedByWeek, []weekCount{{"2026-10-19", 0}}) {
+			t.Errorf("stats of an empty workspace: %+v", empty)
+		}
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s todoStore) {
+		alpha := withWorkspace(t.Context(), "alpha")
+		beta := withWorkspace(t.Context(), "beta")
+		once := mustCreate(t, alpha, s, todo{description: "buy a mystery novel"})
+		twice := mustCreate(t, alpha, s, todo{description: "Mystery, mystery shelf"})
+		mustCreate(t, alpha, s, todo{description: "water the plants"})
+		elsewhere := mustCreate(t, beta, s, todo{description: "mystery mystery mystery"})
+
+		ids := func(results []searchResult) []int {
+			var ids []int
+			for _, r := range results {
+				ids = append(ids, r.Todo.id)
+			}
+			return ids
+		}
+		results, err := s.Search(alpha, "mystery", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(results); !slices.Equal(got, []int{twice.id, once.id}) {
+			t.Fatalf("Search(mystery): %v, want the todo with it twice first, %v", got, []int{twice.id, once.id})
+		}
+		if results[0].Rank <= results[1].Rank || results[0].Todo.description != twice.description {
+			t.Errorf("Search(mystery): %+v", results)
+		}
+		if snippet := results[0].Snippet; !strings.Contains(snippet, "<mark>Mystery</mark>") || strings.Contains(snippet, "<mark>shelf") {
+			t.Errorf("snippet %q", snippet)
+		}
+
+		if results, _ = s.Search(alpha, "mystery", 1); !slices.Equal(ids(results), []int{twice.id}) {
+			t.Errorf("Search with limit 1: %v", ids(results))
+		}
+		if results, _ = s.Search(alpha, "lawnmower", 10); len(results) != 0 {
+			t.Errorf("Search(lawnmower): %v", ids(results))
+		}
+		if results, _ = s.Search(beta, "mystery", 10); !slices.Equal(ids(results), []int{elsewhere.id}) {
+			t.Errorf("Search in beta: %v, want only %d", ids(results), elsewhere.id)
+		}
+	})
+}
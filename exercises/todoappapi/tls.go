@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tlsConfig is where the certificates live, see TODOAPP_TLS_* in config.go
+type tlsConfig struct {
+	certFile       string
+	keyFile        string
+	clientCAFile   string        // set for mutual tls: clients need a certificate signed by this ca
+	reloadInterval time.Duration // how often the files are checked for changes, 0 only reloads on SIGHUP
+}
+
+// certReloader hands out the current certificate and client ca pool to every handshake,
+// so renewed certificates are picked up without a restart. Files are reloaded when their
+// modification time changes or the process gets a SIGHUP. A reload that fails, say because
+// the new key is not in place yet, keeps serving the old certificate.
+type certReloader struct {
+	cfg tlsConfig
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(cfg tlsConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.certFile, r.cfg.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCA *x509.CertPool
+	if r.cfg.clientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.clientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s has no pem certificates", r.cfg.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.clientCA, r.modTimes = &cert, clientCA, r.currentModTimes()
+	return nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.certFile, r.cfg.keyFile}
+	if r.cfg.clientCAFile != "" {
+		files = append(files, r.cfg.clientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) currentModTimes() map[string]time.Time {
+	times := map[string]time.Time{}
+	for _, f := range r.files() {
+		if fi, err := os.Stat(f); err == nil {
+			times[f] = fi.ModTime()
+		}
+	}
+	return times
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for f, t := range r.currentModTimes() {
+		if !t.Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads on SIGHUP and whenever the files change, it never returns
+func (r *certReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if r.cfg.reloadInterval > 0 {
+		tick = time.NewTicker(r.cfg.reloadInterval).C
+	}
+
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.reload(); err != nil {
+			log.Printf("tls: keeping the current certificate, reloading failed: %v", err)
+			continue
+		}
+		log.Print("tls: reloaded certificates")
+	}
+}
+
+// serverConfig is the tls.Config for both the REST and the grpc listener. Both negotiate
+// http/2 through ALPN, REST clients without it fall back to http/1.1.
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		// going through GetConfigForClient lets every handshake see the latest client ca as well
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2", "http/1.1"},
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCA != nil {
+				cfg.ClientCAs = r.clientCA
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// loadTLS returns nil when tls is not configured
+func loadTLS(cfg tlsConfig) (*tls.Config, error) {
+	if cfg.certFile == "" && cfg.keyFile == "" {
+		if cfg.clientCAFile != "" {
+			return nil, errors.New("TODOAPP_TLS_CLIENT_CA needs TODOAPP_TLS_CERT and TODOAPP_TLS_KEY")
+		}
+		return nil, nil
+	}
+	if cfg.certFile == "" || cfg.keyFile == "" {
+		return nil, errors.New("TODOAPP_TLS_CERT and TODOAPP_TLS_KEY go together")
+	}
+
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	go r.watch()
+	return r.serverConfig(), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a fresh self-signed certificate for name and its key to certFile and keyFile.
+// The modification times move forward a second every time, or a rewrite within the same tick of
+// the file system clock would look unchanged.
+func writeCert(t *testing.T, name, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Now().Add(time.Second)
+	if fi, err := os.Stat(certFile); err == nil {
+		modTime = fi.ModTime().Add(time.Second)
+	}
+	for file, block := range map[string]*pem.Block{certFile: {Type: "CERTIFICATE", Bytes: der}, keyFile: {Type: "EC PRIVATE KEY", Bytes: keyDER}} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedName is the common name of the certificate a handshake with addr gets
+func servedName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloaderPicksUpRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := tlsConfig{
+		certFile:       filepath.Join(dir, "cert.pem"),
+		keyFile:        filepath.Join(dir, "key.pem"),
+		reloadInterval: 10 * time.Millisecond,
+	}
+	writeCert(t, "first.test", cfg.certFile, cfg.keyFile)
+
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.watch()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", r.serverConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.NotFoundHandler(), ErrorLog: log.New(io.Discard, "", 0)}
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+	addr := lis.Addr().String()
+
+	if got := servedName(t, addr); got != "first.test" {
+		t.Fatalf("served %s before the rotation, want first.test", got)
+	}
+
+	// a certificate without its key doesn't load, the old one stays
+	os.WriteFile(cfg.keyFile, []byte("not a key"), 0o600)
+	os.Chtimes(cfg.keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	time.Sleep(5 * cfg.reloadInterval)
+	if got := servedName(t, addr); got != "first.test" {
+		t.Fatalf("served %s after a broken rotation, want first.test", got)
+	}
+
+	writeCert(t, "second.test", cfg.certFile, cfg.keyFile)
+	deadline := time.Now().Add(5 * time.Second)
+	for servedName(t, addr) != "second.test" {
+		if time.Now().After(deadline) {
+			t.Fatal("still serving the old certificate after the rotation")
+		}
+		time.Sleep(cfg.reloadInterval)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Tracing follows the OpenTelemetry model without pulling in its sdk: a trace is a tree of spans
+// sharing a trace id, every span has a parent except the root, and finished spans go to an exporter.
+// Incoming W3C traceparent headers (https://www.w3.org/TR/trace-context/) continue the caller's trace.
+//
+// A request gets three levels of spans: the whole request, the handler once mux has routed it,
+// and below that every store call and the json encoding. The gap between the request and the
+// handler span is routing plus the middlewares.
+
+type (
+	traceID [16]byte
+	spanID  [8]byte
+)
+
+func (id traceID) String() string { return hex.EncodeToString(id[:]) }
+func (id spanID) String() string  { return hex.EncodeToString(id[:]) }
+
+type span struct {
+	tracer   *tracer
+	traceID  traceID
+	id       spanID
+	parentID spanID // zero for the root span
+	sampled  bool   // unsampled spans are never exported, their ids still end up in the logs
+
+	mu    sync.Mutex
+	name  string
+	start time.Time
+	end   time.Time
+	attrs map[string]any
+	err   string
+}
+
+func (s *span) setName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *span) setAttr(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// finish ends the span and hands it to the exporter, err marks it as failed
+func (s *span) finish(err error) {
+	s.mu.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.tracer.exporter.export(s)
+	}
+}
+
+func (s *span) duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.end.Sub(s.start)
+}
+
+// spanExporter gets every finished, sampled span
+type spanExporter interface {
+	export(s *span)
+}
+
+type tracer struct {
+	exporter spanExporter
+}
+
+func newTracer(exporter spanExporter) *tracer {
+	return &tracer{exporter: exporter}
+}
+
+// newExporter picks the exporter named by TODOAPP_TRACE_EXPORTER
+func newExporter(name string) (spanExporter, error) {
+	switch name {
+	case "", "none":
+		return discardExporter{}, nil
+	case "stdout":
+		return &writerExporter{w: os.Stdout}, nil
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q, expected none or stdout", name)
+}
+
+type spanContextKey struct{}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanContextKey{}).(*span)
+	return s
+}
+
+// start begins a span under whatever span ctx carries, or a new trace when there is none.
+// attrs are key, value pairs.
+func (t *tracer) start(ctx context.Context, name string, attrs ...any) (context.Context, *span) {
+	s := &span{tracer: t, name: name, start: time.Now(), attrs: map[string]any{}, sampled: true}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID, s.parentID, s.sampled = parent.traceID, parent.id, parent.sampled
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.id[:])
+
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// parseTraceparent reads a version 00 traceparent header, "00-<trace id>-<parent id>-<flags>"
+func parseTraceparent(header string) (*span, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	s := &span{}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(s.traceID[:], []byte(parts[1])); err != nil || s.traceID == (traceID{}) {
+		return nil, false
+	}
+	if _, err := hex.Decode(s.id[:], []byte(parts[2])); err != nil || s.id == (spanID{}) {
+		return nil, false
+	}
+	s.sampled = flags[0]&0x01 == 1
+	return s, true
+}
+
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.traceID, s.id, flags)
+}
+
+// traceRequests wraps the whole router with the request span. It sends the span back as a
+// traceparent header so whoever is looking at a slow request can find its trace.
+func traceRequests(t *tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if remote, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, spanContextKey{}, remote)
+		}
+		ctx, s := t.start(ctx, r.Method, "http.method", r.Method, "http.target", r.URL.Path)
+		rw.Header().Set("traceparent", s.traceparent())
+
+		tw := &tracingWriter{ResponseWriter: rw, ctx: ctx, tracer: t, status: http.StatusOK}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+
+		s.setAttr("http.status_code", tw.status)
+		var err error
+		if tw.status >= 500 {
+			err = fmt.Errorf("%d %s", tw.status, http.StatusText(tw.status))
+		}
+		s.finish(err)
+
+		s.mu.Lock()
+		name := s.name
+		s.mu.Unlock()
+		slog.InfoContext(ctx, "request", "route", name, "status", tw.status, "duration", s.duration())
+	})
+}
+
+// traceHandler goes on the router with router.Use, so it runs once mux has found the route.
+// It names the request span after the route template and starts the handler span.
+func (t *tracer) traceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		name := r.Method
+		if tpl, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+			name += " " + tpl
+		}
+		if parent := spanFromContext(r.Context()); parent != nil {
+			parent.setName(name)
+		}
+
+		ctx, s := t.start(r.Context(), "handle "+name)
+		defer s.finish(nil)
+		next.ServeHTTP(&tracingWriter{ResponseWriter: rw, ctx: ctx, tracer: t, status: http.StatusOK}, r.WithContext(ctx))
+	})
+}
+
+// tracingWriter carries the request's span down to writeJSON, which has no request to get it from
+type tracingWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	tracer *tracer
+	status int
+}
+
+func (w *tracingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *tracingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// requestSpan finds the innermost tracingWriter below rw. ok is false outside of traced requests.
+func requestSpan(rw http.ResponseWriter) (context.Context, *tracer, bool) {
+	for {
+		switch w := rw.(type) {
+		case *tracingWriter:
+			return w.ctx, w.tracer, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			rw = w.Unwrap()
+		default:
+			return context.Background(), nil, false
+		}
+	}
+}
+
+// requestContext is the context of the request rw answers, for log lines that should carry its trace id
+func requestContext(rw http.ResponseWriter) context.Context {
+	ctx, _, _ := requestSpan(rw)
+	return ctx
+}
+
+// traceLogHandler adds trace_id and span_id to every log line written with a traced context
+type traceLogHandler struct {
+	slog.Handler
+}
+
+func (h traceLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if s := spanFromContext(ctx); s != nil {
+		r.AddAttrs(slog.String("trace_id", s.traceID.String()), slog.String("span_id", s.id.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceLogHandler) WithGroup(name string) slog.Handler {
+	return traceLogHandler{h.Handler.WithGroup(name)}
+}
+
+type discardExporter struct{}
+
+func (discardExporter) export(*span) {}
+
+// writerExporter writes one json object per span
+type writerExporter struct {
+	mu sync.Mutex // keeps lines from concurrent requests apart
+	w  io.Writer
+}
+
+func (e *writerExporter) export(s *span) {
+	s.mu.Lock()
+	line := struct {
+		TraceID    string         `json:"trace_id"`
+		SpanID     string         `json:"span_id"`
+		ParentID   string         `json:"parent_id,omitempty"`
+		Name       string         `json:"name"`
+		Start      time.Time      `json:"start"`
+		DurationMS float64        `json:"duration_ms"`
+		Attrs      map[string]any `json:"attrs,omitempty"`
+		Error      string         `json:"error,omitempty"`
+	}{
+		TraceID: s.traceID.String(), SpanID: s.id.String(), Name: s.name, Start: s.start,
+		DurationMS: float64(s.end.Sub(s.start).Microseconds()) / 1000, Attrs: s.attrs, Error: s.err,
+	}
+	if s.parentID != (spanID{}) {
+		line.ParentID = s.parentID.String()
+	}
+	b, err := json.Marshal(line)
+	s.mu.Unlock()
+	if err != nil {
+		slog.Error("tracing: encoding span", "err", err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(b, '\n'))
+}
+
+// memoryExporter keeps spans around to be looked at, in tests for instance
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (e *memoryExporter) export(s *span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// finished returns the spans exported so far, in the order they finished
+func (e *memoryExporter) finished() []*span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*span(nil), e.spans...)
+}
+
+func (e *memoryExporter) reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// tracingStore puts a span around every call into the store. It goes right on top of the
+// database store, below the cache, so a read the cache answered shows up without a store span.
+type tracingStore struct {
+	todoStore
+	tracer *tracer
+}
+
+func newTracingStore(s todoStore, t *tracer) *tracingStore {
+	return &tracingStore{todoStore: s, tracer: t}
+}
+
+func (s *tracingStore) List(ctx context.Context, filter todoFilter) ([]todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.List", "filter", filter.cacheKey())
+	todos, err := s.todoStore.List(ctx, filter)
+	sp.setAttr("todos", len(todos))
+	sp.finish(err)
+	return todos, err
+}
+
+func (s *tracingStore) Get(ctx context.Context, id int) (todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Get", "todo.id", id)
+	t, err := s.todoStore.Get(ctx, id)
+	sp.finish(err)
+	return t, err
+}
+
+func (s *tracingStore) Create(ctx context.Context, t todo) (todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Create")
+	t, err := s.todoStore.Create(ctx, t)
+	sp.setAttr("todo.id", t.id)
+	sp.finish(err)
+	return t, err
+}
+
+func (s *tracingStore) Update(ctx context.Context, t todo) (todo, *todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Update", "todo.id", t.id)
+	t, next, err := s.todoStore.Update(ctx, t)
+	if next != nil {
+		sp.setAttr("next.id", next.id)
+	}
+	sp.finish(err)
+	return t, next, err
+}
+
+func (s *tracingStore) Delete(ctx context.Context, id int) error {
+	ctx, sp := s.tracer.start(ctx, "store.Delete", "todo.id", id)
+	err := s.todoStore.Delete(ctx, id)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) Import(ctx context.Context, todos []todo) ([]todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Import", "todos", len(todos))
+	todos, err := s.todoStore.Import(ctx, todos)
+	sp.finish(err)
+	return todos, err
+}
+
+func (s *tracingStore) Complete(ctx context.Context, id int) (todo, *todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Complete", "todo.id", id)
+	done, next, err := s.todoStore.Complete(ctx, id)
+	if next != nil {
+		sp.setAttr("next.id", next.id)
+	}
+	sp.finish(err)
+	return done, next, err
+}
+
+func (s *tracingStore) Tree(ctx context.Context, id int) (todo, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Tree", "todo.id", id)
+	t, err := s.todoStore.Tree(ctx, id)
+	sp.finish(err)
+	return t, err
+}
+
+func (s *tracingStore) SetParent(ctx context.Context, id, parent int) error {
+	ctx, sp := s.tracer.start(ctx, "store.SetParent", "todo.id", id, "parent.id", parent)
+	err := s.todoStore.SetParent(ctx, id, parent)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) AddBlocker(ctx context.Context, id, blocker int) error {
+	ctx, sp := s.tracer.start(ctx, "store.AddBlocker", "todo.id", id, "blocker.id", blocker)
+	err := s.todoStore.AddBlocker(ctx, id, blocker)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) RemoveBlocker(ctx context.Context, id, blocker int) error {
+	ctx, sp := s.tracer.start(ctx, "store.RemoveBlocker", "todo.id", id, "blocker.id", blocker)
+	err := s.todoStore.RemoveBlocker(ctx, id, blocker)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) Stats(ctx context.Context, today, since time.Time) (todoStats, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Stats")
+	stats, err := s.todoStore.Stats(ctx, today, since)
+	sp.finish(err)
+	return stats, err
+}
+
+func (s *tracingStore) Export(ctx context.Context, todo func(storedTodo) error, reminder func(sentReminder) error) error {
+	ctx, sp := s.tracer.start(ctx, "store.Export")
+	err := s.todoStore.Export(ctx, todo, reminder)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) Restore(ctx context.Context, todos []storedTodo, reminders []sentReminder, replace bool) error {
+	ctx, sp := s.tracer.start(ctx, "store.Restore", "todos", len(todos), "reminders", len(reminders), "replace", replace)
+	err := s.todoStore.Restore(ctx, todos, reminders, replace)
+	sp.finish(err)
+	return err
+}
+
+func (s *tracingStore) Search(ctx context.Context, query string, limit int) ([]searchResult, error) {
+	ctx, sp := s.tracer.start(ctx, "store.Search", "limit", limit)
+	results, err := s.todoStore.Search(ctx, query, limit)
+	sp.setAttr("results", len(results))
+	sp.finish(err)
+	return results, err
+}
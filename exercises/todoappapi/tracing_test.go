@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/jb-start-here/golang-start-here/exercises/todoapp/todopb"
+)
+
+const (
+	callerTrace  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerSpan   = "00f067aa0ba902b7"
+	callerHeader = "00-" + callerTrace + "-" + callerSpan + "-01"
+)
+
+// startTracedAPI is startTestAPI with the spans kept in a memoryExporter
+func startTracedAPI(t *testing.T, base todoStore) (*httptest.Server, *memoryExporter) {
+	t.Helper()
+	exp := &memoryExporter{}
+	tracer := newTracer(exp)
+	setupStore(testConfig(), base, tracer)
+	srv := httptest.NewServer(newHandler(testConfig(), tracer))
+	t.Cleanup(srv.Close)
+	return srv, exp
+}
+
+func get(t *testing.T, url, traceparent string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func spanNamed(t *testing.T, spans []*span, prefix string) *span {
+	t.Helper()
+	for _, s := range spans {
+		if strings.HasPrefix(s.name, prefix) {
+			return s
+		}
+	}
+	t.Fatalf("no %s span", prefix)
+	return nil
+}
+
+func TestTraceparentContinuesTheCallersTrace(t *testing.T) {
+	srv, exp := startTracedAPI(t, newMemoryStore())
+
+	res := get(t, srv.URL+"/todos", callerHeader)
+	back, ok := parseTraceparent(res.Header.Get("traceparent"))
+	if !ok || back.traceID.String() != callerTrace || back.id.String() == callerSpan {
+		t.Errorf("answered with traceparent %q, want a new span in trace %s", res.Header.Get("traceparent"), callerTrace)
+	}
+
+	spans := exp.finished()
+	for _, s := range spans {
+		if s.traceID.String() != callerTrace {
+			t.Errorf("%s is in trace %s, want %s", s.name, s.traceID, callerTrace)
+		}
+	}
+	request := spanNamed(t, spans, "GET /todos")
+	handler := spanNamed(t, spans, "handle GET /todos")
+	list := spanNamed(t, spans, "store.List")
+	if request.parentID.String() != callerSpan || request.id != back.id {
+		t.Errorf("request span %s has parent %s, want %s under %s", request.id, request.parentID, back.id, callerSpan)
+	}
+	if handler.parentID != request.id || list.parentID != handler.id {
+		t.Error("the handler span isn't under the request span, or the store span isn't under the handler")
+	}
+}
+
+func TestTraceparentUnsampledOrBroken(t *testing.T) {
+	srv, exp := startTracedAPI(t, newMemoryStore())
+
+	res := get(t, srv.URL+"/todos", "00-"+callerTrace+"-"+callerSpan+"-00")
+	if got := res.Header.Get("traceparent"); !strings.HasPrefix(got, "00-"+callerTrace+"-") || !strings.HasSuffix(got, "-00") {
+		t.Errorf("answered an unsampled trace with %q", got)
+	}
+	if spans := exp.finished(); len(spans) != 0 {
+		t.Errorf("exported %d spans of an unsampled trace", len(spans))
+	}
+	exp.reset()
+
+	res = get(t, srv.URL+"/todos", "00-"+callerTrace+"-nothex-01")
+	if got := res.Header.Get("traceparent"); strings.Contains(got, callerTrace) {
+		t.Errorf("continued a broken traceparent: %q", got)
+	}
+	if len(exp.finished()) == 0 {
+		t.Error("a broken traceparent isn't traced at all")
+	}
+}
+
+// brokenStore fails every Get the way a database that went away does
+type brokenStore struct{ todoStore }
+
+func (brokenStore) Get(context.Context, int) (todo, error) {
+	return todo{}, errors.New("connection refused")
+}
+
+// captureLogs sends slog's output to the returned buffer, as json, for the length of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(traceLogHandler{slog.NewJSONHandler(&buf, nil)}))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+// errorTraceIDs are the trace ids of the logged errors
+func errorTraceIDs(t *testing.T, logs *bytes.Buffer) []string {
+	t.Helper()
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			Level   string
+			TraceID string `json:"trace_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if entry.Level == "ERROR" {
+			ids = append(ids, entry.TraceID)
+		}
+	}
+	return ids
+}
+
+func TestGraphQLErrorsAreLoggedWithTheTrace(t *testing.T) {
+	srv, _ := startTracedAPI(t, brokenStore{newMemoryStore()})
+	logs := captureLogs(t)
+
+	req, _ := http.NewRequest("POST", srv.URL+"/graphql", strings.NewReader(`{"query": "{ todo(id: \"1\") { id } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", callerHeader)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if ids := errorTraceIDs(t, logs); len(ids) != 1 || ids[0] != callerTrace {
+		t.Errorf("logged errors in traces %q, want one in %s", ids, callerTrace)
+	}
+}
+
+func TestGRPCCallsAreTraced(t *testing.T) {
+	exp := &memoryExporter{}
+	feed := newChangeFeed()
+	c := dialTestGRPC(t, newGRPCServer(testConfig(), nil, newTracer(exp), brokenStore{newMemoryStore()}, feed))
+	logs := captureLogs(t)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", callerHeader)
+	_, err := c.GetTodo(ctx, &todopb.GetTodoRequest{Id: 1}, grpc.Header(&header))
+	expectCode(t, "GetTodo of a broken store", err, codes.Internal)
+
+	if v := header.Get("traceparent"); len(v) != 1 || !strings.Contains(v[0], callerTrace) {
+		t.Errorf("answered with traceparent %q, want one in trace %s", v, callerTrace)
+	}
+	if ids := errorTraceIDs(t, logs); len(ids) != 1 || ids[0] != callerTrace {
+		t.Errorf("logged errors in traces %q, want one in %s", ids, callerTrace)
+	}
+	call := spanNamed(t, exp.finished(), todopb.TodoService_GetTodo_FullMethodName)
+	if call.traceID.String() != callerTrace || call.parentID.String() != callerSpan || call.err == "" {
+		t.Errorf("the call's span is %s under %s in trace %s with error %q", call.id, call.parentID, call.traceID, call.err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Request bodies are checked against a list of rules, one per field, before they turn into
+// anything the stores see. Every rule runs, so a client gets to hear about all of its mistakes
+// at once instead of fixing them one request at a time.
+
+// fieldError is one thing wrong with one field. Field uses the v2 key names, v1 clients get
+// them renamed by forVersion. Reason is what clients switch on and Message is for people.
+type fieldError struct {
+	Field   string
+	Reason  string
+	Message string
+}
+
+const (
+	reasonRequired     = "required"
+	reasonTooLong      = "too_long"
+	reasonTooMany      = "too_many"
+	reasonOutOfRange   = "out_of_range"
+	reasonMalformed    = "malformed"
+	reasonWrongType    = "wrong_type"
+	reasonUnknownField = "unknown_field"
+)
+
+// validationError is everything wrong with a request body, handlers answer it with a 422
+type validationError []fieldError
+
+func (e validationError) Error() string {
+	messages := make([]string, len(e))
+	for i, f := range e {
+		messages[i] = f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// v1FieldNames are the v1 keys, the way todo.MarshalJSON writes them, of the fields the rules
+// know by their v2 names
+var v1FieldNames = map[string]string{
+	"description": "Description",
+	"done":        "Done",
+	"due_date":    "Duedate",
+	"priority":    "Priority",
+	"tags":        "Tags",
+	"project":     "Project",
+	"recurrence":  "Recurrence",
+	"parent_id":   "Parent",
+	"blocked_by":  "BlockedBy",
+}
+
+// forVersion renames the fields to the keys of version v. Messages of the rules start with the
+// field name, it's renamed there too.
+func (e validationError) forVersion(v apiVersion) validationError {
+	if v == apiV2 {
+		return e
+	}
+	renamed := make(validationError, len(e))
+	for i, f := range e {
+		name, index, indexed := strings.Cut(f.Field, "[")
+		if v1, ok := v1FieldNames[name]; ok {
+			if indexed {
+				v1 += "[" + index
+			}
+			if rest, ok := strings.CutPrefix(f.Message, f.Field); ok {
+				f.Message = v1 + rest
+			}
+			f.Field = v1
+		}
+		renamed[i] = f
+	}
+	return renamed
+}
+
+// check looks at the value of a single field. reason is empty when the value is fine.
+type check[V any] func(field string, v V) (reason, message string)
+
+// rule checks one field of a T
+type rule[T any] func(in T) []fieldError
+
+// field runs checks against the value get pulls out of a T, stopping at the first that fails
+func field[T, V any](name string, get func(T) V, checks ...check[V]) rule[T] {
+	return func(in T) []fieldError {
+		v := get(in)
+		for _, c := range checks {
+			if reason, message := c(name, v); reason != "" {
+				return []fieldError{{Field: name, Reason: reason, Message: message}}
+			}
+		}
+		return nil
+	}
+}
+
+// each is field for every item of a list, the items are called name[0], name[1] and so on
+func each[T, V any](name string, get func(T) []V, checks ...check[V]) rule[T] {
+	return func(in T) []fieldError {
+		var errs []fieldError
+		for i, v := range get(in) {
+			item := func(T) V { return v }
+			errs = append(errs, field(fmt.Sprintf("%s[%d]", name, i), item, checks...)(in)...)
+		}
+		return errs
+	}
+}
+
+// validate runs every rule, the error is a validationError
+func validate[T any](in T, rules []rule[T]) error {
+	var errs validationError
+	for _, r := range rules {
+		errs = append(errs, r(in)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func required(field, v string) (string, string) {
+	if strings.TrimSpace(v) == "" {
+		return reasonRequired, field + " is required"
+	}
+	return "", ""
+}
+
+func maxLength(n int) check[string] {
+	return func(field, v string) (string, string) {
+		if utf8.RuneCountInString(v) > n {
+			return reasonTooLong, fmt.Sprintf("%s is longer than %d characters", field, n)
+		}
+		return "", ""
+	}
+}
+
+func maxItems[V any](n int) check[[]V] {
+	return func(field string, v []V) (string, string) {
+		if len(v) > n {
+			return reasonTooMany, fmt.Sprintf("%s has more than %d items", field, n)
+		}
+		return "", ""
+	}
+}
+
+func atLeast(n int) check[int] {
+	return func(field string, v int) (string, string) {
+		if v < n {
+			return reasonOutOfRange, fmt.Sprintf("%s has to be at least %d", field, n)
+		}
+		return "", ""
+	}
+}
+
+// parses accepts whatever parse does, the message is parse's error
+func parses[V, R any](parse func(V) (R, error)) check[V] {
+	return func(_ string, v V) (string, string) {
+		if _, err := parse(v); err != nil {
+			return reasonMalformed, err.Error()
+		}
+		return "", ""
+	}
+}
+
+// maxBodySize is as much json as a single todo could ever need, and then some
+const maxBodySize = 1 << 20
+
+// decodeBody reads a json object of up to maxBodySize into v, which has to point to a struct.
+// Keys v has no field for and values of the wrong type come back as a validationError, a body
+// over the limit as an *http.MaxBytesError and anything that isn't a json object at all as a
+// plain error.
+func decodeBody(rw http.ResponseWriter, body io.ReadCloser, v any) error {
+	raw, err := io.ReadAll(http.MaxBytesReader(rw, body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	return decodeObject(raw, v, "the body")
+}
+
+// decodeObject is decodeBody for json that has been read already, what is the name the error
+// gives raw when it isn't an object
+func decodeObject(raw []byte, v any, what string) error {
+	var keys map[string]json.RawMessage
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(raw, &keys); errors.As(err, &typeErr) {
+		return errors.New(what + " has to be a json object")
+	} else if err != nil {
+		return err
+	}
+
+	var errs validationError
+	known := jsonKeys(reflect.TypeOf(v).Elem())
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, key) }) {
+			errs = append(errs, fieldError{Field: key, Reason: reasonUnknownField, Message: key + " is not a field this endpoint knows"})
+		}
+	}
+
+	// a wrong type doesn't stop the decoder, it fills in everything else and reports the first one
+	if err := json.Unmarshal(raw, v); errors.As(err, &typeErr) {
+		errs = append(errs, fieldError{Field: typeErr.Field, Reason: reasonWrongType, Message: fmt.Sprintf("%s has to be a %s, not a %s", typeErr.Field, typeErr.Type, typeErr.Value)})
+	} else if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// joinValidation merges the validationErrors of decodeBody and of the rules run on what it
+// decoded, keeping only the first problem with every field. Any other error wins as is.
+func joinValidation(errs ...error) error {
+	var joined validationError
+	for _, err := range errs {
+		var invalid validationError
+		if err != nil && !errors.As(err, &invalid) {
+			return err
+		}
+		for _, f := range invalid {
+			if !slices.ContainsFunc(joined, func(j fieldError) bool { return j.Field == f.Field }) {
+				joined = append(joined, f)
+			}
+		}
+	}
+	if len(joined) > 0 {
+		return joined
+	}
+	return nil
+}
+
+// jsonKeys is every key encoding/json decodes into a field of struct type t
+func jsonKeys(t reflect.Type) []string {
+	var keys []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+// spaces is an endless json body that never turns into a syntax error
+type spaces struct{}
+
+func (spaces) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func TestBodiesOverTheLimit(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	tests := []struct {
+		path  string
+		limit int64
+	}{
+		{"/todos", maxBodySize},
+		{"/v2/todos", maxBodySize},
+		{"/todos/import?format=json", maxImportSize},
+	}
+	for _, tt := range tests {
+		res, err := http.Post(srv.URL+tt.path, "application/json", io.LimitReader(spaces{}, tt.limit+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("POST %s with %d bytes: got %d, want 413", tt.path, tt.limit+1, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAcceptedVersion(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   apiVersion
+		ok     bool
+	}{
+		{"", apiV1, true},
+		{"*/*", apiV1, true},
+		{"application/json", apiV1, true},
+		{"text/html", apiV1, true},
+		{"application/vnd.todoapp.v1+json", apiV1, true},
+		{"application/vnd.todoapp.v2+json", apiV2, true},
+		{"application/json, application/vnd.todoapp.v2+json", apiV2, true},
+		{"application/vnd.todoapp.v2+json; q=0.9, application/json", apiV2, true},
+		{"application/vnd.todoapp.v9+json", apiV1, false},
+		{"application/vnd.todoapp.v9+json, application/json", apiV1, true},
+		{"application/vnd.todoapp.v9+json, application/vnd.todoapp.v2+json", apiV2, true},
+		{"application/vnd.other+json, application/json", apiV1, true},
+		{"application/vnd.todoapp.v9+json, not a media type", apiV1, false},
+	}
+	for _, tt := range tests {
+		got, ok := acceptedVersion(tt.accept)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("acceptedVersion(%q) = %v, %v, want %v, %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidationFieldsUseTheVersionsNames(t *testing.T) {
+	srv := startTestAPI(t, testConfig(), nil)
+	long := strings.Repeat("x", 51)
+
+	tests := []struct {
+		path, body string
+		fields     []string
+		message    string
+	}{
+		{"/todos", `{"Description": "", "Duedate": "someday", "Tags": ["` + long + `"], "Parent": -1}`,
+			[]string{"Description", "Duedate", "Tags[0]", "Parent"}, "Description is required"},
+		{"/v2/todos", `{"description": "", "due_date": "someday", "tags": ["` + long + `"], "parent_id": -1}`,
+			[]string{"description", "due_date", "tags[0]", "parent_id"}, "description is required"},
+	}
+	for _, tt := range tests {
+		res, err := http.Post(srv.URL+tt.path, "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Fields []struct{ Field, Message string }
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+
+		var fields []string
+		for _, f := range body.Fields {
+			fields = append(fields, f.Field)
+		}
+		if !slices.Equal(fields, tt.fields) {
+			t.Errorf("POST %s: fields %q, want %q", tt.path, fields, tt.fields)
+		}
+		if len(body.Fields) > 0 && body.Fields[0].Message != tt.message {
+			t.Errorf("POST %s: message %q, want %q", tt.path, body.Fields[0].Message, tt.message)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Every todo belongs to a workspace, so teams can share one deployment without seeing each
+// other's todos. Each request is for exactly one workspace and every todoStore method only
+// sees the todos in the workspace of its context. Ids are still unique across all of them,
+// and projects and tags are plain names that every workspace shares.
+//
+// Which workspace a request is for comes from the api key it was made with when
+// TODOAPP_WORKSPACE_KEYS hands out one key per workspace, or from the X-Workspace header.
+// Nothing checks who sends the header, so it is only taken along with TODOAPP_API_KEY, or from
+// anyone at all when TODOAPP_OPEN_WORKSPACES says the deployment doesn't need to keep them apart.
+
+const defaultWorkspace = "default"
+
+var (
+	// errUnauthorized means the api key is missing or not one of the configured ones
+	errUnauthorized = errors.New("a valid api key is required")
+	// errWrongWorkspace means the api key belongs to a workspace other than the one asked for
+	errWrongWorkspace = errors.New("the api key is not for this workspace")
+	// errWorkspaceHeader means X-Workspace came without an api key that may pick workspaces
+	errWorkspaceHeader = errors.New("picking a workspace with X-Workspace takes the api key")
+	// errInvalidWorkspace is a workspace name that could never have been created
+	errInvalidWorkspace = errors.New("workspace names are 1 to 63 lowercase letters, digits, - and _")
+)
+
+var workspaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type workspaceKey struct{}
+
+func withWorkspace(ctx context.Context, workspace string) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, workspace)
+}
+
+// workspaceOf is the workspace ctx is scoped to, the default one when nothing picked another.
+// The stores call it on every method, so subcommands and background jobs that never set one
+// work on the default workspace.
+func workspaceOf(ctx context.Context) string {
+	if w, ok := ctx.Value(workspaceKey{}).(string); ok {
+		return w
+	}
+	return defaultWorkspace
+}
+
+// workspaceKeys maps api keys to the workspace they are for. A workspace can have several keys,
+// a key only one workspace.
+type workspaceKeys map[string]string
+
+// parseWorkspaceKeys reads TODOAPP_WORKSPACE_KEYS, a list of workspace=key pairs
+func parseWorkspaceKeys(pairs []string) workspaceKeys {
+	keys := workspaceKeys{}
+	for _, pair := range pairs {
+		workspace, key, ok := strings.Cut(pair, "=")
+		switch {
+		case !ok || key == "":
+			log.Fatalf("TODOAPP_WORKSPACE_KEYS: %q is not workspace=key", pair)
+		case !workspaceName.MatchString(workspace):
+			log.Fatalf("TODOAPP_WORKSPACE_KEYS: %q: %v", workspace, errInvalidWorkspace)
+		case keys[key] != "" && keys[key] != workspace:
+			log.Fatalf("TODOAPP_WORKSPACE_KEYS: the same key is given to %s and %s", keys[key], workspace)
+		}
+		keys[key] = workspace
+	}
+	return keys
+}
+
+// resolveWorkspace works out the workspace from the Authorization and X-Workspace values of a
+// request, over REST and grpc alike.
+//
+// With workspace keys configured the key decides and a header naming another workspace is
+// refused. TODOAPP_API_KEY then is the admin key, which can pick any workspace by header.
+// Without workspace keys the header decides, requireAPIKey has checked the key already. With no
+// key at all the header is refused unless TODOAPP_OPEN_WORKSPACES is set.
+func resolveWorkspace(cfg config, authorization, header string) (string, error) {
+	if len(cfg.workspaceKeys) > 0 {
+		token, _ := strings.CutPrefix(authorization, "Bearer ")
+		workspace, ok := cfg.workspaceKeys.lookup(token)
+		if ok {
+			if header != "" && header != workspace {
+				return "", errWrongWorkspace
+			}
+			return workspace, nil
+		}
+		if cfg.apiKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.apiKey)) != 1 {
+			return "", errUnauthorized
+		}
+	} else if header != "" && !cfg.openWorkspaces && !isAdmin(cfg, authorization) {
+		return "", errWorkspaceHeader
+	}
+
+	if header == "" {
+		return defaultWorkspace, nil
+	}
+	if !workspaceName.MatchString(header) {
+		return "", errInvalidWorkspace
+	}
+	return header, nil
+}
+
+// lookup compares token with every key, in constant time like requireAPIKey does
+func (k workspaceKeys) lookup(token string) (string, bool) {
+	var workspace string
+	for key, w := range k {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			workspace = w
+		}
+	}
+	return workspace, workspace != ""
+}
+
+// scopeToWorkspace puts the workspace of every request into its context
+func scopeToWorkspace(cfg config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			workspace, err := resolveWorkspace(cfg, r.Header.Get("Authorization"), r.Header.Get("X-Workspace"))
+			switch {
+			case errors.Is(err, errUnauthorized):
+				rw.Header().Set("WWW-Authenticate", `Bearer realm="todos"`)
+				writeError(rw, http.StatusUnauthorized, "unauthorized", err.Error())
+				return
+			case errors.Is(err, errWrongWorkspace):
+				writeError(rw, http.StatusForbidden, "wrong_workspace", err.Error())
+				return
+			case errors.Is(err, errWorkspaceHeader):
+				writeError(rw, http.StatusForbidden, "workspace_not_allowed", err.Error())
+				return
+			case err != nil:
+				writeError(rw, http.StatusBadRequest, "invalid_workspace", err.Error())
+				return
+			}
+			if sp := spanFromContext(r.Context()); sp != nil {
+				sp.setAttr("workspace", workspace)
+			}
+			next.ServeHTTP(rw, r.WithContext(withWorkspace(r.Context(), workspace)))
+		})
+	}
+}
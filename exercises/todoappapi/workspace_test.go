@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveWorkspace(t *testing.T) {
+	open := testConfig()
+	open.openWorkspaces = true
+	single := testConfig()
+	single.apiKey = "k"
+	keyed := testConfig()
+	keyed.apiKey = "admin"
+	keyed.workspaceKeys = workspaceKeys{"ka": "alpha"}
+
+	tests := []struct {
+		name          string
+		cfg           config
+		authorization string
+		header        string
+		want          string
+		err           error
+	}{
+		{"no keys", testConfig(), "", "", defaultWorkspace, nil},
+		{"no keys with a header", testConfig(), "", "beta", "", errWorkspaceHeader},
+		{"no keys with a made up key", testConfig(), "Bearer k", "beta", "", errWorkspaceHeader},
+		{"TODOAPP_OPEN_WORKSPACES", open, "", "beta", "beta", nil},
+		{"TODOAPP_OPEN_WORKSPACES with a bad name", open, "", "Not Valid", "", errInvalidWorkspace},
+		{"the api key", single, "Bearer k", "beta", "beta", nil},
+		{"a workspace key", keyed, "Bearer ka", "", "alpha", nil},
+		{"a workspace key asking for another", keyed, "Bearer ka", "beta", "", errWrongWorkspace},
+		{"the admin key", keyed, "Bearer admin", "beta", "beta", nil},
+		{"no key with workspace keys", keyed, "", "beta", "", errUnauthorized},
+	}
+	for _, tt := range tests {
+		got, err := resolveWorkspace(tt.cfg, tt.authorization, tt.header)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}